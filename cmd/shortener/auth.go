@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+
+	"github.com/zueve/go-shortener/internal/auth"
+	"github.com/zueve/go-shortener/internal/config"
+)
+
+// newTokenSigner loads token keys from the keys file or AUTH_KEYS. Without keys
+// tokens are signed by a random key and reset on restart, so users lose their
+// links. It is allowed only with the in-memory storage, where links are lost too.
+func newTokenSigner(conf config.Config, logger zerolog.Logger) (*auth.Signer, error) {
+	var (
+		keys []auth.Key
+		err  error
+	)
+	if conf.AuthKeysFile != "" {
+		keys, err = auth.LoadKeysFile(conf.AuthKeysFile)
+	} else {
+		keys, err = auth.ParseKeys(conf.AuthKeys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		if conf.FileStoragePath != "" || conf.DatabaseDSN != "" {
+			return nil, errors.New("token keys are required with a persistent storage, set AUTH_KEYS or AUTH_KEYS_FILE; " +
+				"to keep tokens issued by older versions add \"legacy:somesecretstring\" as a verify-only key, see README")
+		}
+		logger.Warn().Msg("No token keys configured, use a random key, tokens are reset on restart")
+		return auth.NewRandomSigner()
+	}
+
+	logger.Info().Str("signing_key", keys[0].ID).Int("keys", len(keys)).Msg("Use token keys")
+	return auth.NewSigner(keys...)
+}
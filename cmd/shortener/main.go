@@ -2,18 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"syscall"
 
-	"github.com/jmoiron/sqlx"
-
-	_ "github.com/jackc/pgx/v4/stdlib"
 	"github.com/zueve/go-shortener/internal/config"
+	"github.com/zueve/go-shortener/internal/grpcserver"
+	"github.com/zueve/go-shortener/internal/metrics"
 	"github.com/zueve/go-shortener/internal/server"
 	"github.com/zueve/go-shortener/internal/services"
 	"github.com/zueve/go-shortener/internal/storage"
+	"github.com/zueve/go-shortener/internal/tracing"
+	"github.com/zueve/go-shortener/pkg/logging"
 )
 
 func main() {
@@ -22,43 +26,171 @@ func main() {
 		panic(err)
 	}
 
-	db, err := sqlx.Open("pgx", conf.DatabaseDSN)
+	logFile, err := logging.Setup(logging.Config{
+		Level:      conf.LogLevel,
+		Format:     conf.LogFormat,
+		Output:     conf.LogOutput,
+		MaxSize:    int64(conf.LogMaxSizeMB) << 20,
+		MaxBackups: conf.LogMaxBackups,
+		Redact: logging.RedactConfig{
+			QueryParams: conf.LogRedactParams,
+			AnonymizeIP: conf.LogAnonymizeIP,
+		},
+	})
 	if err != nil {
 		panic(err)
 	}
-	defer db.Close()
+	defer logFile.Close()
+
+	logger := logging.NewLogger().With().
+		Str(logging.Source, "main").
+		Logger()
+
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		if err := runMigrate(conf, logger, args[1:]); err != nil {
+			logger.Fatal().Err(err).Msg("Migration failed")
+		}
+		return
+	}
 
-	if err = storage.Migrate(db); err != nil {
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    conf.TraceExporter,
+		Endpoint:    conf.TraceOTLPEndpoint,
+		Insecure:    conf.TraceOTLPInsecure,
+		File:        conf.TraceFile,
+		SampleRatio: conf.TraceSampleRatio,
+	})
+	if err != nil {
 		panic(err)
 	}
+	logger.Info().Str("exporter", conf.TraceExporter).Msg("Use trace exporter")
+
+	var metricsVar *metrics.Metrics
+	if conf.MetricsEnabled {
+		metricsVar = metrics.New()
+	}
 
-	storageVar, err := storage.New(db)
+	storageVar, err := openStorage(conf, logger, metricsVar)
 	if err != nil {
 		panic(err)
 	}
-	serviceVar := services.New(storageVar)
+	// the database storage is taken before wrapping to check its schema version
+	dbStorage, _ := storageVar.(*storage.Storage)
+	if metricsVar != nil {
+		storageVar = metrics.NewStorage(storageVar, metricsVar)
+	}
+	if conf.TraceExporter != tracing.ExporterNone {
+		storageVar = tracing.NewStorage(storageVar)
+	}
+
+	if conf.KeyStrategy == services.KeyStrategyObfuscated && conf.KeySecret == "" {
+		panic("KEY_SECRET is required by the obfuscated key strategy")
+	}
+	keys, err := services.NewKeyGenerator(conf.KeyStrategy, conf.KeyLength, conf.KeySecret)
+	if err != nil {
+		panic(err)
+	}
+	logger.Info().Str("strategy", conf.KeyStrategy).Msg("Use key strategy")
+
+	if conf.SweepMode != "archive" && conf.SweepMode != "purge" {
+		panic(fmt.Sprintf("unknown expired sweep mode %q", conf.SweepMode))
+	}
+	if _, ok := services.RedirectStatuses[conf.RedirectStatus]; !ok {
+		panic(fmt.Sprintf("unsupported redirect status %d", conf.RedirectStatus))
+	}
+
+	signer, err := newTokenSigner(conf, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	serviceOpts := []services.ServiceOption{
+		services.WithKeyGenerator(keys),
+		services.WithExpiredSweep(conf.SweepInterval, conf.SweepMode == "archive"),
+		services.WithSessionTTL(conf.SessionTTL),
+		services.WithMetrics(metricsVar),
+		services.WithRedirectStatus(conf.RedirectStatus),
+	}
+	if dbStorage != nil {
+		serviceOpts = append(serviceOpts, services.WithReadinessCheck("migrations", dbStorage.CheckMigrations))
+	}
+	serviceVar := services.New(storageVar, serviceOpts...)
 	serverVar, err := server.New(
 		serviceVar,
 		server.WithAddress(conf.ServerAddress),
 		server.WithURL(conf.BaseURL),
+		server.WithTokenSigner(signer),
+		server.WithRedirectLogSampling(conf.LogRedirectSample),
+		server.WithMetrics(metricsVar),
+		server.WithRedirectMaxAge(conf.RedirectCacheMaxAge),
 	)
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println("Started at", conf.ServerAddress)
-	go serverVar.ListenAndServe()
+	// serveErrors gets errors of servers stopped not by shutdown
+	serveErrors := make(chan error, 2)
+	logger.Info().Str("address", conf.ServerAddress).Msg("Started HTTP server")
+	go func() {
+		if err := serverVar.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErrors <- fmt.Errorf("HTTP server: %w", err)
+		}
+	}()
+
+	var grpcServerVar *grpcserver.Server
+	if conf.GRPCAddress != "" {
+		grpcServerVar, err = grpcserver.New(
+			serviceVar,
+			grpcserver.WithAddress(conf.GRPCAddress),
+			grpcserver.WithURL(conf.BaseURL),
+			grpcserver.WithTokenSigner(signer),
+		)
+		if err != nil {
+			panic(err)
+		}
+		logger.Info().Str("address", conf.GRPCAddress).Msg("Started gRPC server")
+		go func() {
+			if err := grpcServerVar.ListenAndServe(); err != nil {
+				serveErrors <- fmt.Errorf("gRPC server: %w", err)
+			}
+		}()
+	}
 
-	// Setting up signal capturing
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
 
-	// Waiting for SIGINT (kill -2)
-	<-stop
+	exitCode := 0
+	select {
+	case sig := <-stop:
+		logger.Info().Str("signal", sig.String()).Msg("Shutting down")
+	case err := <-serveErrors:
+		logger.Error().Err(err).Msg("Server failed, shutting down")
+		exitCode = 1
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), conf.ShutdownTimeout)
 	defer cancel()
-	if err := serverVar.Shutdown(ctx); err != nil {
-		panic("unexpected err on graceful shutdown")
+	err = shutdown(ctx, logger,
+		shutdownPhase{"drain", func(ctx context.Context) error {
+			serverVar.Drain()
+			return wait(ctx, conf.ShutdownDelay)
+		}},
+		shutdownPhase{"http", serverVar.Shutdown},
+		shutdownPhase{"grpc", func(ctx context.Context) error {
+			if grpcServerVar == nil {
+				return nil
+			}
+			return grpcServerVar.Shutdown(ctx)
+		}},
+		shutdownPhase{"background work", serviceVar.Close},
+		shutdownPhase{"storage", func(context.Context) error {
+			return storageVar.Close()
+		}},
+		shutdownPhase{"tracing", shutdownTracing},
+	)
+	if err != nil {
+		exitCode = 1
 	}
-	fmt.Println("main: done. exiting")
+	logger.Info().Int("exit_code", exitCode).Msg("Stopped")
+	logFile.Close()
+	os.Exit(exitCode)
 }
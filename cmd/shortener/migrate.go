@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/zueve/go-shortener/internal/config"
+	"github.com/zueve/go-shortener/internal/storage"
+)
+
+const migrateUsage = "usage: shortener [flags] migrate up|down [steps]|status"
+
+// runMigrate handles `shortener migrate up|down|status` against DATABASE_DSN.
+func runMigrate(conf config.Config, logger zerolog.Logger, args []string) error {
+	if conf.DatabaseDSN == "" {
+		return errors.New("migrations require DATABASE_DSN")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	db, err := openDB(conf.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := storage.MigrateUp(db)
+		for _, version := range applied {
+			logger.Info().Int("version", version).Msg("Migration applied")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		reverted, err := storage.MigrateDown(db, steps)
+		for _, version := range reverted {
+			logger.Info().Int("version", version).Msg("Migration reverted")
+		}
+		return err
+	case "status":
+		states, err := storage.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(os.Stdout, "%4d  %-30s %s\n", state.Version, state.Name, appliedAt)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// shutdownPhase is a named step of the shutdown.
+type shutdownPhase struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// shutdown runs phases in order until ctx is done. A failed phase does not stop
+// the next ones, so the storage is closed anyway, the first error is returned.
+func shutdown(ctx context.Context, logger zerolog.Logger, phases ...shutdownPhase) error {
+	var result error
+	for _, phase := range phases {
+		start := time.Now()
+		logger.Info().Str("phase", phase.name).Msg("Shutdown phase started")
+		if err := phase.run(ctx); err != nil {
+			logger.Error().Err(err).Str("phase", phase.name).Dur("duration", time.Since(start)).Msg("Shutdown phase failed")
+			if result == nil {
+				result = err
+			}
+			continue
+		}
+		logger.Info().Str("phase", phase.name).Dur("duration", time.Since(start)).Msg("Shutdown phase done")
+	}
+	return result
+}
+
+// wait sleeps for the duration or until ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
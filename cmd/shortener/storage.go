@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+
+	_ "github.com/jackc/pgx/v4/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/zueve/go-shortener/internal/config"
+	"github.com/zueve/go-shortener/internal/metrics"
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/internal/storage"
+)
+
+const sqliteScheme = "sqlite://"
+
+type closableStorage interface {
+	services.StorageExpected
+	io.Closer
+}
+
+// openStorage picks the storage backend by config precedence:
+// database DSN, then file storage path, then in-memory storage.
+// Pool stats of the database are exported to metrics, they may be nil.
+func openStorage(conf config.Config, logger zerolog.Logger, m *metrics.Metrics) (closableStorage, error) {
+	switch {
+	case conf.DatabaseDSN != "":
+		db, err := openDB(conf.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		if err = storage.Migrate(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		if err = m.RegisterDB(db.DB, db.DriverName()); err != nil {
+			db.Close()
+			return nil, err
+		}
+		logger.Info().Str("driver", db.DriverName()).Msg("Use database storage")
+		return storage.New(db)
+	case conf.FileStoragePath != "":
+		logger.Info().Str("path", conf.FileStoragePath).Msg("Use file storage")
+		return storage.NewFileStorage(conf.FileStoragePath)
+	default:
+		logger.Info().Msg("Use in-memory storage")
+		return storage.NewMemoryStorage(), nil
+	}
+}
+
+// openDB opens postgres by default or sqlite for DSN with sqlite:// scheme.
+// Foreign keys are enabled for sqlite to match postgres.
+func openDB(dsn string) (*sqlx.DB, error) {
+	driver := "pgx"
+	if strings.HasPrefix(dsn, sqliteScheme) {
+		driver, dsn = "sqlite3", strings.TrimPrefix(dsn, sqliteScheme)
+		if !strings.Contains(dsn, "_foreign_keys=") {
+			separator := "?"
+			if strings.Contains(dsn, "?") {
+				separator = "&"
+			}
+			dsn += separator + "_foreign_keys=1"
+		}
+	}
+	db, err := sqlx.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite3" {
+		// sqlite does not support concurrent writers and
+		// every connection to :memory: is a separate database
+		db.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
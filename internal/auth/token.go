@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// keySeparator splits the key id and the signed user id in a token
+	keySeparator = "."
+	// LegacyKeyID is the id of a key that validates tokens issued before
+	// key ids were embedded in tokens
+	LegacyKeyID = "legacy"
+
+	userIDSize = 16
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrNoKeys       = errors.New("no signing keys")
+)
+
+// Key signs tokens, ID is embedded in tokens to find the key on validation.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Signer issues tokens with the signing key and validates tokens signed
+// by any known key, so keys can be rotated without logging users out.
+type Signer struct {
+	signing Key
+	keys    map[string]Key
+}
+
+// NewSigner uses the first key for signing, the rest are verify-only.
+func NewSigner(keys ...Key) (*Signer, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	s := &Signer{
+		signing: keys[0],
+		keys:    make(map[string]Key, len(keys)),
+	}
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, keySeparator) || len(key.Secret) == 0 {
+			return nil, fmt.Errorf("invalid key %q", key.ID)
+		}
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicated key %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+	if s.signing.ID == LegacyKeyID {
+		return nil, errors.New("legacy key can't be used for signing")
+	}
+	return s, nil
+}
+
+// NewRandomSigner makes a signer with a random key, tokens are valid until restart.
+func NewRandomSigner() (*Signer, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return NewSigner(Key{ID: "random", Secret: secret})
+}
+
+// ParseKeys parses keys in form "id:secret" separated by commas or new lines.
+func ParseKeys(value string) ([]Key, error) {
+	keys := make([]Key, 0)
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(value, ",", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("key must be in form id:secret")
+		}
+		keys = append(keys, Key{ID: parts[0], Secret: []byte(parts[1])})
+	}
+	return keys, scanner.Err()
+}
+
+// LoadKeysFile reads keys from a file, one "id:secret" per line.
+func LoadKeysFile(path string) ([]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeys(string(data))
+}
+
+// Validate checks that the token is a user id signed by a known key.
+func (s *Signer) Validate(token string) bool {
+	keyID, data, err := split(token)
+	if err != nil || len(data) != userIDSize+sha256.Size {
+		return false
+	}
+	key, ok := s.keys[keyID]
+	if !ok {
+		return false
+	}
+	return hmac.Equal(sign(key, data[:userIDSize]), data[userIDSize:])
+}
+
+// Generate makes a token for a new anonymous user.
+func (s *Signer) Generate() (string, error) {
+	id, err := uuid.New().MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	token := append(id, sign(s.signing, id)...)
+
+	return s.signing.ID + keySeparator + hex.EncodeToString(token), nil
+}
+
+// UserID extracts the user id from a token, the token must be validated before.
+func UserID(token string) (string, error) {
+	_, data, err := split(token)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < userIDSize {
+		return "", ErrInvalidToken
+	}
+	return hex.EncodeToString(data[:userIDSize]), nil
+}
+
+// split returns the key id and decoded data of a token, tokens without key id are legacy.
+func split(token string) (string, []byte, error) {
+	keyID := LegacyKeyID
+	if i := strings.Index(token, keySeparator); i >= 0 {
+		keyID, token = token[:i], token[i+1:]
+	}
+	data, err := hex.DecodeString(token)
+	if err != nil {
+		return "", nil, ErrInvalidToken
+	}
+	return keyID, data, nil
+}
+
+// sign binds the signature to the key id, legacy tokens were signed by the user id only.
+func sign(key Key, id []byte) []byte {
+	h := hmac.New(sha256.New, key.Secret)
+	if key.ID != LegacyKeyID {
+		h.Write([]byte(key.ID + keySeparator))
+	}
+	h.Write(id)
+	return h.Sum(nil)
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigner_Rotation(t *testing.T) {
+	assert := assert.New(t)
+
+	old, err := NewSigner(Key{ID: "k1", Secret: []byte("first")})
+	assert.Nil(err)
+	token, err := old.Generate()
+	assert.Nil(err)
+	assert.True(old.Validate(token))
+
+	keys, err := ParseKeys("k2:second, k1:first")
+	assert.Nil(err)
+	rotated, err := NewSigner(keys...)
+	assert.Nil(err)
+	assert.True(rotated.Validate(token))
+
+	newToken, err := rotated.Generate()
+	assert.Nil(err)
+	assert.Contains(newToken, "k2.")
+	assert.False(old.Validate(newToken))
+
+	dropped, err := NewSigner(Key{ID: "k2", Secret: []byte("second")})
+	assert.Nil(err)
+	assert.False(dropped.Validate(token))
+
+	// key id can't be swapped to another key
+	forged := "k2" + token[len("k1"):]
+	assert.False(rotated.Validate(forged))
+	assert.False(rotated.Validate(""))
+	assert.False(rotated.Validate("k2.zz"))
+}
+
+func TestSigner_Legacy(t *testing.T) {
+	assert := assert.New(t)
+
+	id := make([]byte, userIDSize)
+	h := hmac.New(sha256.New, []byte("somesecretstring"))
+	h.Write(id)
+	token := hex.EncodeToString(append(id, h.Sum(nil)...))
+
+	signer, err := NewSigner(Key{ID: "k1", Secret: []byte("first")})
+	assert.Nil(err)
+	assert.False(signer.Validate(token))
+
+	signer, err = NewSigner(
+		Key{ID: "k1", Secret: []byte("first")},
+		Key{ID: LegacyKeyID, Secret: []byte("somesecretstring")},
+	)
+	assert.Nil(err)
+	assert.True(signer.Validate(token))
+
+	userID, err := UserID(token)
+	assert.Nil(err)
+	assert.Equal(hex.EncodeToString(id), userID)
+
+	_, err = NewSigner(Key{ID: LegacyKeyID, Secret: []byte("somesecretstring")})
+	assert.NotNil(err)
+}
@@ -0,0 +1,67 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/zueve/go-shortener/internal/auth"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// tokenMetadataKey is the same token as the X-Token cookie of the HTTP API.
+const tokenMetadataKey = "x-token"
+
+type ctxKey string
+
+const ctxKeyUserID = ctxKey("userID")
+
+// authInterceptor identifies the user by the x-token metadata, it is either a signed
+// token or an account session token. A caller without a valid token becomes a new user
+// and gets the token in the response header.
+func (s *Server) authInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tokenMetadataKey); len(values) > 0 {
+			token = values[0]
+		}
+	}
+
+	if token != "" && !s.tokens.Validate(token) {
+		session, err := s.service.GetSession(ctx, token)
+		if err == nil {
+			return handler(context.WithValue(ctx, ctxKeyUserID, session.UserID), req)
+		} else if !errors.Is(err, services.ErrSessionNotFound) {
+			return nil, status.Error(codes.Internal, "can't check session")
+		}
+	}
+
+	if !s.tokens.Validate(token) {
+		var err error
+		token, err = s.tokens.Generate()
+		if err != nil {
+			return nil, status.Error(codes.Internal, "problem with token generation")
+		}
+		if err := grpc.SetHeader(ctx, metadata.Pairs(tokenMetadataKey, token)); err != nil {
+			return nil, status.Error(codes.Internal, "can't set token")
+		}
+	}
+	userID, err := auth.UserID(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return handler(context.WithValue(ctx, ctxKeyUserID, userID), req)
+}
+
+func getUserID(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(ctxKeyUserID).(string)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "user is not identified")
+	}
+	return userID, nil
+}
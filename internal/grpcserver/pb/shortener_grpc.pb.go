@@ -0,0 +1,249 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: internal/grpcserver/pb/shortener.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// ShortenerClient is the client API for Shortener service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ShortenerClient interface {
+	CreateRedirect(ctx context.Context, in *CreateRedirectRequest, opts ...grpc.CallOption) (*CreateRedirectResponse, error)
+	CreateRedirectByBatch(ctx context.Context, in *CreateRedirectByBatchRequest, opts ...grpc.CallOption) (*CreateRedirectByBatchResponse, error)
+	GetURLByKey(ctx context.Context, in *GetURLByKeyRequest, opts ...grpc.CallOption) (*GetURLByKeyResponse, error)
+	GetAllUserURLs(ctx context.Context, in *GetAllUserURLsRequest, opts ...grpc.CallOption) (*GetAllUserURLsResponse, error)
+	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
+}
+
+type shortenerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewShortenerClient(cc grpc.ClientConnInterface) ShortenerClient {
+	return &shortenerClient{cc}
+}
+
+func (c *shortenerClient) CreateRedirect(ctx context.Context, in *CreateRedirectRequest, opts ...grpc.CallOption) (*CreateRedirectResponse, error) {
+	out := new(CreateRedirectResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/CreateRedirect", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) CreateRedirectByBatch(ctx context.Context, in *CreateRedirectByBatchRequest, opts ...grpc.CallOption) (*CreateRedirectByBatchResponse, error) {
+	out := new(CreateRedirectByBatchResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/CreateRedirectByBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetURLByKey(ctx context.Context, in *GetURLByKeyRequest, opts ...grpc.CallOption) (*GetURLByKeyResponse, error) {
+	out := new(GetURLByKeyResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetURLByKey", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) GetAllUserURLs(ctx context.Context, in *GetAllUserURLsRequest, opts ...grpc.CallOption) (*GetAllUserURLsResponse, error) {
+	out := new(GetAllUserURLsResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/GetAllUserURLs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shortenerClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
+	out := new(PingResponse)
+	err := c.cc.Invoke(ctx, "/shortener.Shortener/Ping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ShortenerServer is the server API for Shortener service.
+// All implementations must embed UnimplementedShortenerServer
+// for forward compatibility
+type ShortenerServer interface {
+	CreateRedirect(context.Context, *CreateRedirectRequest) (*CreateRedirectResponse, error)
+	CreateRedirectByBatch(context.Context, *CreateRedirectByBatchRequest) (*CreateRedirectByBatchResponse, error)
+	GetURLByKey(context.Context, *GetURLByKeyRequest) (*GetURLByKeyResponse, error)
+	GetAllUserURLs(context.Context, *GetAllUserURLsRequest) (*GetAllUserURLsResponse, error)
+	Ping(context.Context, *PingRequest) (*PingResponse, error)
+	mustEmbedUnimplementedShortenerServer()
+}
+
+// UnimplementedShortenerServer must be embedded to have forward compatible implementations.
+type UnimplementedShortenerServer struct {
+}
+
+func (UnimplementedShortenerServer) CreateRedirect(context.Context, *CreateRedirectRequest) (*CreateRedirectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRedirect not implemented")
+}
+func (UnimplementedShortenerServer) CreateRedirectByBatch(context.Context, *CreateRedirectByBatchRequest) (*CreateRedirectByBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateRedirectByBatch not implemented")
+}
+func (UnimplementedShortenerServer) GetURLByKey(context.Context, *GetURLByKeyRequest) (*GetURLByKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetURLByKey not implemented")
+}
+func (UnimplementedShortenerServer) GetAllUserURLs(context.Context, *GetAllUserURLsRequest) (*GetAllUserURLsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAllUserURLs not implemented")
+}
+func (UnimplementedShortenerServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedShortenerServer) mustEmbedUnimplementedShortenerServer() {}
+
+// UnsafeShortenerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ShortenerServer will
+// result in compilation errors.
+type UnsafeShortenerServer interface {
+	mustEmbedUnimplementedShortenerServer()
+}
+
+func RegisterShortenerServer(s grpc.ServiceRegistrar, srv ShortenerServer) {
+	s.RegisterService(&Shortener_ServiceDesc, srv)
+}
+
+func _Shortener_CreateRedirect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRedirectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).CreateRedirect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/CreateRedirect",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).CreateRedirect(ctx, req.(*CreateRedirectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_CreateRedirectByBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRedirectByBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).CreateRedirectByBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/CreateRedirectByBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).CreateRedirectByBatch(ctx, req.(*CreateRedirectByBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetURLByKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetURLByKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetURLByKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetURLByKey",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetURLByKey(ctx, req.(*GetURLByKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_GetAllUserURLs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAllUserURLsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).GetAllUserURLs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/GetAllUserURLs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).GetAllUserURLs(ctx, req.(*GetAllUserURLsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Shortener_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShortenerServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/shortener.Shortener/Ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShortenerServer).Ping(ctx, req.(*PingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Shortener_ServiceDesc is the grpc.ServiceDesc for Shortener service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Shortener_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shortener.Shortener",
+	HandlerType: (*ShortenerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateRedirect",
+			Handler:    _Shortener_CreateRedirect_Handler,
+		},
+		{
+			MethodName: "CreateRedirectByBatch",
+			Handler:    _Shortener_CreateRedirectByBatch_Handler,
+		},
+		{
+			MethodName: "GetURLByKey",
+			Handler:    _Shortener_GetURLByKey_Handler,
+		},
+		{
+			MethodName: "GetAllUserURLs",
+			Handler:    _Shortener_GetAllUserURLs_Handler,
+		},
+		{
+			MethodName: "Ping",
+			Handler:    _Shortener_Ping_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/grpcserver/pb/shortener.proto",
+}
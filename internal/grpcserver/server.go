@@ -0,0 +1,282 @@
+package grpcserver
+
+//go:generate sh -c "cd ../.. && buf generate"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/zueve/go-shortener/internal/auth"
+	"github.com/zueve/go-shortener/internal/grpcserver/pb"
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// Server exposes the service by gRPC, see pb/shortener.proto.
+type Server struct {
+	pb.UnimplementedShortenerServer
+	service       services.Service
+	srv           *grpc.Server
+	serverAddress string
+	serviceURL    string
+	pingTimeout   time.Duration
+	tokens        *auth.Signer
+}
+
+type ServerOption func(*Server) error
+
+func WithAddress(address string) ServerOption {
+	return func(s *Server) error {
+		s.serverAddress = address
+		return nil
+	}
+}
+
+func WithURL(url string) ServerOption {
+	return func(s *Server) error {
+		s.serviceURL = url
+		return nil
+	}
+}
+
+// WithTokenSigner sets keys of user tokens, by default tokens are signed by a random key.
+func WithTokenSigner(signer *auth.Signer) ServerOption {
+	return func(s *Server) error {
+		s.tokens = signer
+		return nil
+	}
+}
+
+func New(service services.Service, opts ...ServerOption) (*Server, error) {
+	const (
+		defaultServerAddress = ":3200"
+		defaultServiceURL    = "http://localhost:8080"
+		defaultPingTimeout   = 1 * time.Second
+	)
+
+	s := &Server{
+		service:       service,
+		serverAddress: defaultServerAddress,
+		serviceURL:    defaultServiceURL,
+		pingTimeout:   defaultPingTimeout,
+	}
+
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.tokens == nil {
+		signer, err := auth.NewRandomSigner()
+		if err != nil {
+			return nil, err
+		}
+		s.tokens = signer
+	}
+
+	s.srv = grpc.NewServer(grpc.UnaryInterceptor(s.authInterceptor))
+	pb.RegisterShortenerServer(s.srv, s)
+
+	return s, nil
+}
+
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.serverAddress)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	return s.srv.Serve(listener)
+}
+
+// Shutdown waits for running calls, they are cancelled when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.srv.Stop()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) CreateRedirect(ctx context.Context, req *pb.CreateRedirectRequest) (*pb.CreateRedirectResponse, error) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if req.Url == "" {
+		return nil, status.Error(codes.InvalidArgument, "invalid url")
+	}
+	expiresAt, err := services.ExpiryTime(timeOrNil(req.ExpiresAt), req.TtlSeconds, time.Now())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.log(ctx).Info().Str("url", req.Url).Msg("Create redirect")
+	response := &pb.CreateRedirectResponse{}
+	var existErr *services.LinkExistError
+	key, err := s.service.CreateRedirect(ctx, services.Link{
+		Key:            req.Alias,
+		URL:            req.Url,
+		UserID:         userID,
+		ExpiresAt:      expiresAt,
+		RedirectStatus: int(req.RedirectStatus),
+		MergeQuery:     req.MergeQuery,
+		ForwardPath:    req.ForwardPath,
+	})
+	if errors.As(err, &existErr) {
+		key = existErr.Key
+		response.AlreadyExists = true
+	} else if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	response.Key = key
+	response.ShortUrl = s.shortURL(key)
+	return response, nil
+}
+
+func (s *Server) CreateRedirectByBatch(ctx context.Context, req *pb.CreateRedirectByBatchRequest) (*pb.CreateRedirectByBatchResponse, error) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]services.Link, len(req.Items))
+	now := time.Now()
+	for i, item := range req.Items {
+		expiresAt, err := services.ExpiryTime(timeOrNil(item.ExpiresAt), item.TtlSeconds, now)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		links[i] = services.Link{
+			URL:            item.Url,
+			UserID:         userID,
+			ExpiresAt:      expiresAt,
+			RedirectStatus: int(item.RedirectStatus),
+			MergeQuery:     item.MergeQuery,
+			ForwardPath:    item.ForwardPath,
+		}
+	}
+
+	keys, err := s.service.CreateRedirectByBatch(ctx, links)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	response := &pb.CreateRedirectByBatchResponse{Items: make([]*pb.BatchResult, len(keys))}
+	for i := range keys {
+		response.Items[i] = &pb.BatchResult{
+			CorrelationId: req.Items[i].CorrelationId,
+			ShortUrl:      s.shortURL(keys[i]),
+		}
+	}
+	return response, nil
+}
+
+func (s *Server) GetURLByKey(ctx context.Context, req *pb.GetURLByKeyRequest) (*pb.GetURLByKeyResponse, error) {
+	url, err := s.service.GetURLByKey(ctx, req.Key)
+	if errors.Is(err, services.ErrLinkDeleted) || errors.Is(err, services.ErrLinkExpired) {
+		return nil, s.error(ctx, err)
+	} else if err != nil {
+		s.log(ctx).Error().Err(err).Msg("invalid key")
+		return nil, status.Error(codes.NotFound, "invalid key")
+	}
+	return &pb.GetURLByKeyResponse{Url: url}, nil
+}
+
+func (s *Server) GetAllUserURLs(ctx context.Context, req *pb.GetAllUserURLsRequest) (*pb.GetAllUserURLsResponse, error) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.service.GetAllUserURLs(ctx, userID)
+	if err != nil {
+		return nil, s.error(ctx, err)
+	}
+	response := &pb.GetAllUserURLsResponse{Urls: make([]*pb.UserURL, len(links))}
+	for i, link := range links {
+		response.Urls[i] = &pb.UserURL{
+			ShortUrl:    s.shortURL(link.Key),
+			OriginalUrl: link.URL,
+		}
+		if link.ExpiresAt != nil {
+			response.Urls[i].ExpiresAt = timestamppb.New(*link.ExpiresAt)
+		}
+	}
+	return response, nil
+}
+
+func (s *Server) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.pingTimeout)
+	defer cancel()
+	if err := s.service.Ping(ctx); err != nil {
+		return nil, s.error(ctx, err)
+	}
+	return &pb.PingResponse{}, nil
+}
+
+// error maps service errors to gRPC statuses with their public messages,
+// wrapped causes and unknown errors are logged and hidden.
+func (s *Server) error(ctx context.Context, err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, services.ErrValidation):
+		code = codes.InvalidArgument
+	case errors.Is(err, services.ErrConflict):
+		code = codes.AlreadyExists
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, services.ErrGone):
+		code = codes.NotFound
+	case errors.Is(err, services.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, services.ErrUnauthorized):
+		code = codes.Unauthenticated
+	case errors.Is(err, services.ErrUnavailable):
+		code = codes.Unavailable
+	default:
+		s.log(ctx).Error().Err(err).Msg("internal server error")
+		return status.Error(codes.Internal, "internal server error")
+	}
+	msg := services.PublicMessage(err)
+	if msg != err.Error() {
+		s.log(ctx).Warn().Err(err).Msg(msg)
+	}
+	return status.Error(code, msg)
+}
+
+func (s *Server) shortURL(key string) string {
+	return fmt.Sprintf("%s/%s", s.serviceURL, key)
+}
+
+func (s *Server) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "GRPCServer").
+		Str(logging.Layer, "api").
+		Logger()
+
+	return &logger
+}
+
+func timeOrNil(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
@@ -0,0 +1,88 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/zueve/go-shortener/internal/grpcserver/pb"
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/internal/storage"
+)
+
+func newTestClient(t *testing.T) pb.ShortenerClient {
+	service := services.New(storage.NewMemoryStorage())
+	s, err := New(service)
+	assert.Nil(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go s.Serve(listener)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithInsecure(),
+	)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		s.Shutdown(context.Background())
+		service.Close(context.Background())
+	})
+	return pb.NewShortenerClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	client := newTestClient(t)
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// the first call issues a token
+	var header metadata.MD
+	resp, err := client.CreateRedirect(ctx, &pb.CreateRedirectRequest{Url: "http://example.com"}, grpc.Header(&header))
+	assert.Nil(err)
+	assert.Equal("http://localhost:8080/1", resp.ShortUrl)
+	tokens := header.Get(tokenMetadataKey)
+	assert.Len(tokens, 1)
+	userCtx := metadata.AppendToOutgoingContext(ctx, tokenMetadataKey, tokens[0])
+
+	resp, err = client.CreateRedirect(userCtx, &pb.CreateRedirectRequest{Url: "http://example.com"})
+	assert.Nil(err)
+	assert.True(resp.AlreadyExists)
+	assert.Equal("1", resp.Key)
+
+	_, err = client.CreateRedirect(userCtx, &pb.CreateRedirectRequest{Url: "http://example.com/api", Alias: "api"})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	batch, err := client.CreateRedirectByBatch(userCtx, &pb.CreateRedirectByBatchRequest{
+		Items: []*pb.BatchItem{{CorrelationId: "a", Url: "http://example.com/a"}},
+	})
+	assert.Nil(err)
+	assert.Equal("a", batch.Items[0].CorrelationId)
+
+	url, err := client.GetURLByKey(ctx, &pb.GetURLByKeyRequest{Key: "1"})
+	assert.Nil(err)
+	assert.Equal("http://example.com", url.Url)
+
+	_, err = client.GetURLByKey(ctx, &pb.GetURLByKeyRequest{Key: "unknown"})
+	assert.Equal(codes.NotFound, status.Code(err))
+
+	urls, err := client.GetAllUserURLs(userCtx, &pb.GetAllUserURLsRequest{})
+	assert.Nil(err)
+	assert.Len(urls.Urls, 2)
+
+	urls, err = client.GetAllUserURLs(ctx, &pb.GetAllUserURLsRequest{})
+	assert.Nil(err)
+	assert.Empty(urls.Urls)
+
+	_, err = client.Ping(ctx, &pb.PingRequest{})
+	assert.Nil(err)
+}
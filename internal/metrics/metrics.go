@@ -0,0 +1,143 @@
+// Package metrics collects Prometheus metrics of the shortener.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shortener"
+
+// Metrics holds collectors of a registry, a nil Metrics records nothing.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	linksCreated    *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+	gzipRatio       prometheus.Histogram
+}
+
+// New creates metrics in a new registry with Go runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Redirect lookups by result: hit or miss.",
+		}, []string{"result"}),
+		linksCreated: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "links_created_total",
+			Help:      "Created links by mode: single or batch, and result: created or conflict.",
+		}, []string{"mode", "result"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_query_duration_seconds",
+			Help:      "Storage query latency by method and result: ok or error.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"method", "result"}),
+		gzipRatio: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "gzip_compression_ratio",
+			Help:      "Ratio of compressed to original size of gzipped responses.",
+			Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.linksCreated,
+		m.storageDuration,
+		m.gzipRatio,
+	)
+	return m
+}
+
+// Handler serves metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterDB exports connection pool stats of the database.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest records a handled HTTP request.
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// ObserveRedirect records a lookup of a redirect.
+func (m *Metrics) ObserveRedirect(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveLinksCreated records created links or a conflict with an existing link.
+func (m *Metrics) ObserveLinksCreated(mode string, count int, conflict bool) {
+	if m == nil {
+		return
+	}
+	if conflict {
+		m.linksCreated.WithLabelValues(mode, "conflict").Inc()
+		return
+	}
+	m.linksCreated.WithLabelValues(mode, "created").Add(float64(count))
+}
+
+// ObserveStorage records a storage query.
+func (m *Metrics) ObserveStorage(method string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.storageDuration.WithLabelValues(method, result).Observe(duration.Seconds())
+}
+
+// ObserveGzip records sizes of a compressed response.
+func (m *Metrics) ObserveGzip(original, compressed int) {
+	if m == nil || original == 0 {
+		return
+	}
+	m.gzipRatio.Observe(float64(compressed) / float64(original))
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/internal/storage"
+)
+
+func TestMetrics_nil(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.ObserveRequest(http.MethodGet, "/", http.StatusOK, time.Millisecond)
+		m.ObserveRedirect(true)
+		m.ObserveLinksCreated(services.LinkModeSingle, 1, false)
+		m.ObserveStorage("Get", time.Millisecond, nil)
+		m.ObserveGzip(10, 5)
+	})
+}
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+	m := New()
+	ctx := context.Background()
+	s := NewStorage(storage.NewMemoryStorage(), m)
+	service := services.New(s, services.WithMetrics(m))
+	defer service.Close(ctx)
+
+	key, err := service.CreateRedirect(ctx, services.Link{URL: "https://example.com", UserID: "user"})
+	assert.Nil(err)
+	_, err = service.CreateRedirect(ctx, services.Link{URL: "https://example.com", UserID: "user"})
+	assert.ErrorIs(err, services.ErrConflict)
+	_, err = service.CreateRedirectByBatch(ctx, []services.Link{
+		{URL: "https://example.com/1", UserID: "user"},
+		{URL: "https://example.com/2", UserID: "user"},
+	})
+	assert.Nil(err)
+	_, err = service.GetURLByKey(ctx, key)
+	assert.Nil(err)
+	_, err = service.GetURLByKey(ctx, "unknown")
+	assert.ErrorIs(err, services.ErrNotFound)
+
+	assert.Equal(1.0, testutil.ToFloat64(m.linksCreated.WithLabelValues(services.LinkModeSingle, "created")))
+	assert.Equal(1.0, testutil.ToFloat64(m.linksCreated.WithLabelValues(services.LinkModeSingle, "conflict")))
+	assert.Equal(2.0, testutil.ToFloat64(m.linksCreated.WithLabelValues(services.LinkModeBatch, "created")))
+	assert.Equal(1.0, testutil.ToFloat64(m.redirects.WithLabelValues("hit")))
+	assert.Equal(1.0, testutil.ToFloat64(m.redirects.WithLabelValues("miss")))
+
+	w := httptest.NewRecorder()
+	m.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(w.Body.String(), `shortener_storage_query_duration_seconds_count{method="Get",result="ok"} 2`)
+	assert.Contains(w.Body.String(), `shortener_storage_query_duration_seconds_count{method="AddByBatch",result="ok"} 1`)
+	assert.Contains(w.Body.String(), "go_goroutines")
+	// missing keys and conflicts are not storage errors
+	assert.NotContains(w.Body.String(), `result="error"`)
+}
@@ -0,0 +1,23 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/observe"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// NewStorage measures latency of every storage query.
+func NewStorage(next services.StorageExpected, metrics *Metrics) *observe.Storage {
+	return observe.NewStorage(next, func(ctx context.Context, method string) (context.Context, func(error)) {
+		start := time.Now()
+		return ctx, func(err error) {
+			var failure error
+			if observe.IsFailure(err) {
+				failure = err
+			}
+			metrics.ObserveStorage(method, time.Since(start), failure)
+		}
+	})
+}
@@ -0,0 +1,152 @@
+// Package observe wraps storage queries with hooks of monitoring packages.
+package observe
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// Hook is called before a storage query, the returned func gets the query error.
+type Hook func(ctx context.Context, method string) (context.Context, func(err error))
+
+// Storage calls the hook around every query to the wrapped storage.
+type Storage struct {
+	next services.StorageExpected
+	hook Hook
+}
+
+// NewStorage wraps the storage, Close is passed through when the storage has it.
+func NewStorage(next services.StorageExpected, hook Hook) *Storage {
+	return &Storage{next: next, hook: hook}
+}
+
+// IsFailure reports whether the query error is a failure of storage,
+// missing rows and conflicts are regular results.
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, services.ErrNotFound) && !errors.Is(err, services.ErrConflict)
+}
+
+func (s *Storage) start(ctx context.Context, method string) (context.Context, func(err error) error) {
+	ctx, end := s.hook(ctx, method)
+	return ctx, func(err error) error {
+		end(err)
+		return err
+	}
+}
+
+func (s *Storage) Get(ctx context.Context, key string) (services.Link, error) {
+	ctx, done := s.start(ctx, "Get")
+	result, err := s.next.Get(ctx, key)
+	return result, done(err)
+}
+
+func (s *Storage) Add(ctx context.Context, link services.Link, keyFunc services.KeyFunc) (string, error) {
+	ctx, done := s.start(ctx, "Add")
+	result, err := s.next.Add(ctx, link, keyFunc)
+	return result, done(err)
+}
+
+func (s *Storage) AddByBatch(ctx context.Context, links []services.Link, keyFunc services.KeyFunc) ([]string, error) {
+	ctx, done := s.start(ctx, "AddByBatch")
+	result, err := s.next.AddByBatch(ctx, links, keyFunc)
+	return result, done(err)
+}
+
+func (s *Storage) GetAllUserURLs(ctx context.Context, userID string) ([]services.Link, error) {
+	ctx, done := s.start(ctx, "GetAllUserURLs")
+	result, err := s.next.GetAllUserURLs(ctx, userID)
+	return result, done(err)
+}
+
+func (s *Storage) Delete(ctx context.Context, tasks []services.DeleteTask) error {
+	ctx, done := s.start(ctx, "Delete")
+	return done(s.next.Delete(ctx, tasks))
+}
+
+func (s *Storage) SweepExpired(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	ctx, done := s.start(ctx, "SweepExpired")
+	result, err := s.next.SweepExpired(ctx, before, archive)
+	return result, done(err)
+}
+
+func (s *Storage) AddClicks(ctx context.Context, clicks []services.Click) error {
+	ctx, done := s.start(ctx, "AddClicks")
+	return done(s.next.AddClicks(ctx, clicks))
+}
+
+func (s *Storage) GetStats(ctx context.Context, key string, since time.Time, bucket time.Duration) (services.LinkStats, error) {
+	ctx, done := s.start(ctx, "GetStats")
+	result, err := s.next.GetStats(ctx, key, since, bucket)
+	return result, done(err)
+}
+
+func (s *Storage) AddAccount(ctx context.Context, account services.Account) error {
+	ctx, done := s.start(ctx, "AddAccount")
+	return done(s.next.AddAccount(ctx, account))
+}
+
+func (s *Storage) GetAccount(ctx context.Context, login string) (services.Account, error) {
+	ctx, done := s.start(ctx, "GetAccount")
+	result, err := s.next.GetAccount(ctx, login)
+	return result, done(err)
+}
+
+func (s *Storage) AddSession(ctx context.Context, session services.Session) error {
+	ctx, done := s.start(ctx, "AddSession")
+	return done(s.next.AddSession(ctx, session))
+}
+
+func (s *Storage) GetSession(ctx context.Context, id string) (services.Session, error) {
+	ctx, done := s.start(ctx, "GetSession")
+	result, err := s.next.GetSession(ctx, id)
+	return result, done(err)
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id string) error {
+	ctx, done := s.start(ctx, "DeleteSession")
+	return done(s.next.DeleteSession(ctx, id))
+}
+
+func (s *Storage) MoveUserLinks(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	ctx, done := s.start(ctx, "MoveUserLinks")
+	result, err := s.next.MoveUserLinks(ctx, fromUserID, toUserID)
+	return result, done(err)
+}
+
+func (s *Storage) AddAPIKey(ctx context.Context, key services.APIKey) error {
+	ctx, done := s.start(ctx, "AddAPIKey")
+	return done(s.next.AddAPIKey(ctx, key))
+}
+
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (services.APIKey, error) {
+	ctx, done := s.start(ctx, "GetAPIKey")
+	result, err := s.next.GetAPIKey(ctx, hash)
+	return result, done(err)
+}
+
+func (s *Storage) GetUserAPIKeys(ctx context.Context, userID string) ([]services.APIKey, error) {
+	ctx, done := s.start(ctx, "GetUserAPIKeys")
+	result, err := s.next.GetUserAPIKeys(ctx, userID)
+	return result, done(err)
+}
+
+func (s *Storage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	ctx, done := s.start(ctx, "DeleteAPIKey")
+	return done(s.next.DeleteAPIKey(ctx, userID, id))
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	ctx, done := s.start(ctx, "Ping")
+	return done(s.next.Ping(ctx))
+}
+
+func (s *Storage) Close() error {
+	if closer, ok := s.next.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
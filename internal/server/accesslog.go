@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+const ctxKeyAccess = ctxKey("access")
+
+// accessRecord collects request details known only to inner handlers.
+type accessRecord struct {
+	userID string
+}
+
+// accessLogHandler writes one line per request and records request metrics,
+// it must follow requestIDHandler to get the correlation ID.
+func (s *Server) accessLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		record := &accessRecord{}
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), ctxKeyAccess, record)))
+
+		latency := time.Since(start)
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// unmatched paths are not used as labels to keep the number of series bounded
+		metricsRoute := route
+		if metricsRoute == "" {
+			metricsRoute = "unmatched"
+		}
+		s.metrics.ObserveRequest(r.Method, metricsRoute, status, latency)
+		if route == "" {
+			route = r.URL.Path
+		}
+
+		logger := accessLog(r.Context())
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = logger.Error()
+		case status >= http.StatusBadRequest:
+			event = logger.Warn()
+		default:
+			event = logger.Info()
+		}
+		event.
+			Str("method", r.Method).
+			Str("route", route).
+			Int("status", status).
+			Int("bytes", ww.BytesWritten()).
+			Dur("latency", latency).
+			Str("user_id", record.userID).
+			Str("remote_ip", r.RemoteAddr).
+			Msg("Request handled")
+	})
+}
+
+// setAccessUserID passes the user id to the access log of the request.
+func setAccessUserID(ctx context.Context, userID string) {
+	if record, ok := ctx.Value(ctxKeyAccess).(*accessRecord); ok {
+		record.userID = userID
+	}
+}
+
+func accessLog(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "accessLog").
+		Str(logging.Layer, "api").
+		Logger()
+
+	return &logger
+}
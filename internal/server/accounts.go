@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	credentials, ok := s.readCredentials(w, r)
+	if !ok {
+		return
+	}
+	account, err := s.service.Register(s.context(r), credentials.Login, credentials.Password)
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+
+	response, err := json.Marshal(Account{UserID: account.ID, Login: account.Login})
+	if s.internalError(w, r, err) {
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+// login starts a session, the token is set as a cookie and returned for bearer use.
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	credentials, ok := s.readCredentials(w, r)
+	if !ok {
+		return
+	}
+	id, err := getIdentity(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	var mergeUserID string
+	if credentials.MergeAnonymous && id.Anonymous {
+		mergeUserID = id.UserID
+	}
+
+	token, session, err := s.service.Login(s.context(r), credentials.Login, credentials.Password, mergeUserID)
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+
+	response, err := json.Marshal(Session{UserID: session.UserID, Token: token, ExpiresAt: session.ExpiresAt})
+	if s.internalError(w, r, err) {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// the response carries the session token
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdentity(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	if !id.Anonymous {
+		if s.internalError(w, r, s.service.Logout(s.context(r), id.Token)) {
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) readCredentials(w http.ResponseWriter, r *http.Request) (Credentials, bool) {
+	var credentials Credentials
+	if r.Header.Get("Content-Type") != "application/json" {
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		return credentials, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil {
+		s.error(w, r, http.StatusBadRequest, "invalid body", nil)
+		return credentials, false
+	}
+	return credentials, true
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// requireScope rejects API keys without the scope, other callers have full access.
+func (s *Server) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := getIdentity(r)
+			if err != nil {
+				s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+				return
+			}
+			if id.APIKey != nil && !id.APIKey.HasScope(scope) {
+				s.serviceError(w, r, services.WithDetail(services.ErrScopeNotAllowed, "%s is required", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireUser rejects API keys, they can't manage keys and sessions.
+func (s *Server) requireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := getIdentity(r)
+		if err != nil {
+			s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+			return
+		}
+		if id.APIKey != nil {
+			s.error(w, r, http.StatusForbidden, "not allowed for api keys", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserID(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/json" {
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		return
+	}
+	var request APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.error(w, r, http.StatusBadRequest, "invalid body", nil)
+		return
+	}
+
+	token, key, err := s.service.CreateAPIKey(s.context(r), userID, request.Name, request.Scopes)
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+
+	result := newAPIKey(key)
+	result.Key = token
+	response, err := json.Marshal(result)
+	if s.internalError(w, r, err) {
+		return
+	}
+	// the response carries the key secret
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(response)
+}
+
+func (s *Server) getAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserID(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	keys, err := s.service.GetUserAPIKeys(s.context(r), userID)
+	if s.internalError(w, r, err) {
+		return
+	}
+
+	result := make([]APIKey, len(keys))
+	for i := range keys {
+		result[i] = newAPIKey(keys[i])
+	}
+	response, err := json.Marshal(result)
+	if s.internalError(w, r, err) {
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserID(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	err = s.service.RevokeAPIKey(s.context(r), userID, chi.URLParam(r, "apiKeyID"))
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAPIKey(key services.APIKey) APIKey {
+	return APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+}
@@ -21,22 +21,39 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-func gzipHandle(next http.Handler) http.Handler {
+// countingWriter counts bytes passed to the writer.
+type countingWriter struct {
+	io.Writer
+	n int
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	w.n += n
+	return n, err
+}
+
+func (s *Server) gzipHandle(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
 			next.ServeHTTP(w, r)
 			return
 		}
 
-		gz, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
+		compressed := &countingWriter{Writer: w}
+		gz, err := gzip.NewWriterLevel(compressed, gzip.BestSpeed)
 		if err != nil {
 			io.WriteString(w, err.Error())
 			return
 		}
-		defer gz.Close()
+		original := &countingWriter{Writer: gz}
+		defer func() {
+			gz.Close()
+			s.metrics.ObserveGzip(original.n, compressed.n)
+		}()
 
 		w.Header().Set("Content-Encoding", "gzip")
-		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: gz}, r)
+		next.ServeHTTP(gzipWriter{ResponseWriter: w, Writer: original}, r)
 	})
 }
 
@@ -2,41 +2,82 @@ package server
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"net/http"
+	"strings"
 
-	"github.com/google/uuid"
 	"github.com/rs/zerolog"
+	"github.com/zueve/go-shortener/internal/auth"
+	"github.com/zueve/go-shortener/internal/services"
 	"github.com/zueve/go-shortener/pkg/logging"
 )
 
 const (
-	tokenHeaderName = "X-Token"
-	tokenHeaderAge  = 3000
-	secret          = "somesecretstring"
+	tokenHeaderName   = "X-Token"
+	tokenHeaderAge    = 3000
+	sessionCookieName = "X-Session"
+	bearerPrefix      = "Bearer "
 )
 
-func setCookieHandler(next http.Handler) http.Handler {
+type ctxKey string
+
+const ctxKeyIdentity = ctxKey("identity")
+
+// identity is the caller resolved by setCookieHandler.
+type identity struct {
+	UserID string
+	// Token is a signed token of an anonymous user or a session token of an account
+	Token     string
+	Anonymous bool
+	// APIKey is set when the caller is limited by API key scopes
+	APIKey *services.APIKey
+}
+
+// setCookieHandler identifies the caller by a bearer token, a session cookie
+// or an anonymous token cookie, a new anonymous user gets the cookie.
+func (s *Server) setCookieHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenCookie, err := r.Cookie(tokenHeaderName)
 		logger := log(r.Context())
+
+		// API clients send the token by header, they don't get a cookie
+		if token, ok := bearerToken(r); ok {
+			id, err := s.authenticate(r.Context(), token)
+			if errors.Is(err, services.ErrSessionNotFound) || errors.Is(err, services.ErrAPIKeyNotFound) {
+				s.error(w, r, http.StatusUnauthorized, "invalid token", nil)
+				return
+			} else if s.internalError(w, r, err) {
+				return
+			}
+			next.ServeHTTP(w, withIdentity(r, id))
+			return
+		}
+
+		if sessionCookie, err := r.Cookie(sessionCookieName); err == nil {
+			session, err := s.service.GetSession(r.Context(), sessionCookie.Value)
+			if err == nil {
+				next.ServeHTTP(w, withIdentity(r, identity{UserID: session.UserID, Token: sessionCookie.Value}))
+				return
+			} else if !errors.Is(err, services.ErrSessionNotFound) {
+				s.internalError(w, r, err)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Path: "/", MaxAge: -1})
+		}
+
+		tokenCookie, err := r.Cookie(tokenHeaderName)
 		var token string
 		if err == http.ErrNoCookie {
 			token = ""
-		} else if err != nil {
-			logger.Error().Err(err).Msg("Can't read cookie")
-			cancel(w)
+		} else if s.internalError(w, r, err) {
+			return
 		} else {
 			token = tokenCookie.Value
 		}
 
-		if !validateToken(token) {
-			token, err = generateToken()
-			if err != nil {
-				logger.Error().Err(err).Msg("problen with token generation")
-				cancel(w)
+		if !s.tokens.Validate(token) {
+			token, err = s.tokens.Generate()
+			if s.internalError(w, r, err) {
+				return
 			}
 			cookie := &http.Cookie{
 				Name:   tokenHeaderName,
@@ -44,61 +85,66 @@ func setCookieHandler(next http.Handler) http.Handler {
 				MaxAge: tokenHeaderAge,
 				Path:   "/",
 			}
-			logger.Info().Msgf("Set token %s:%s", cookie.Name, cookie.Value)
+			logger.Info().Str("token", cookie.Value).Msg("Set token cookie")
 			http.SetCookie(w, cookie)
 			r.AddCookie(cookie)
 		}
 
-		next.ServeHTTP(w, r)
+		userID, err := auth.UserID(token)
+		if s.internalError(w, r, err) {
+			return
+		}
+		next.ServeHTTP(w, withIdentity(r, identity{UserID: userID, Token: token, Anonymous: true}))
 	})
 }
 
-func validateToken(token string) bool {
-	data, err := hex.DecodeString(token)
-	if err != nil || len(data) < 32 {
-		return false
+// authenticate accepts signed anonymous tokens, session tokens and API keys.
+func (s *Server) authenticate(ctx context.Context, token string) (identity, error) {
+	if strings.HasPrefix(token, services.APIKeyPrefix) {
+		key, err := s.service.GetAPIKey(ctx, token)
+		if err != nil {
+			return identity{}, err
+		}
+		return identity{UserID: key.UserID, Token: token, APIKey: &key}, nil
 	}
-	id := data[:16]
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(id)
-	sign := h.Sum(nil)
-
-	return hmac.Equal(sign, data[16:])
+	if s.tokens.Validate(token) {
+		userID, err := auth.UserID(token)
+		return identity{UserID: userID, Token: token, Anonymous: true}, err
+	}
+	session, err := s.service.GetSession(ctx, token)
+	if err != nil {
+		return identity{}, err
+	}
+	return identity{UserID: session.UserID, Token: token}, nil
 }
 
-func generateToken() (string, error) {
-	id, err := uuid.New().MarshalBinary()
-	if err != nil {
-		return "", err
+// bearerToken returns the token of the Authorization header if it is set.
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
 	}
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(id)
-	sign := h.Sum(nil)
-	token := append(id, sign...)
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
 
-	return hex.EncodeToString(token), nil
+func withIdentity(r *http.Request, id identity) *http.Request {
+	setAccessUserID(r.Context(), id.UserID)
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyIdentity, id))
 }
 
-func getUserID(r *http.Request) (string, error) {
-	tokenCookie, err := r.Cookie(tokenHeaderName)
-	if err != nil {
-		log(r.Context()).Error().Err(err)
-		return "", err
+func getIdentity(r *http.Request) (identity, error) {
+	id, ok := r.Context().Value(ctxKeyIdentity).(identity)
+	if !ok {
+		err := errors.New("user is not identified")
+		log(r.Context()).Error().Err(err).Send()
+		return identity{}, err
 	}
-	token := tokenCookie.Value
-	data, err := hex.DecodeString(token)
-	if err != nil {
-		log(r.Context()).Error().Err(err)
-		return "", err
-	}
-	id := data[:16]
-	return hex.EncodeToString(id), nil
+	return id, nil
 }
 
-func cancel(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Header().Set("content-type", "plain/text")
-	w.Write([]byte("internal server error"))
+func getUserID(r *http.Request) (string, error) {
+	id, err := getIdentity(r)
+	return id.UserID, err
 }
 
 func log(ctx context.Context) *zerolog.Logger {
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// errorCodes are codes of the JSON error envelope by HTTP status.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:           "bad_request",
+	http.StatusUnauthorized:         "unauthorized",
+	http.StatusForbidden:            "forbidden",
+	http.StatusNotFound:             "not_found",
+	http.StatusConflict:             "conflict",
+	http.StatusGone:                 "gone",
+	http.StatusUnsupportedMediaType: "unsupported_media_type",
+	http.StatusInternalServerError:  "internal_error",
+	http.StatusServiceUnavailable:   "unavailable",
+}
+
+// errorKinds map kinds of service errors to HTTP statuses and envelope codes.
+var errorKinds = []struct {
+	kind   error
+	status int
+	code   string
+}{
+	{services.ErrValidation, http.StatusBadRequest, "validation_error"},
+	{services.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{services.ErrForbidden, http.StatusForbidden, "forbidden"},
+	{services.ErrNotFound, http.StatusNotFound, "not_found"},
+	{services.ErrConflict, http.StatusConflict, "conflict"},
+	{services.ErrGone, http.StatusGone, "gone"},
+	{services.ErrUnavailable, http.StatusServiceUnavailable, "unavailable"},
+}
+
+// errorFields are request fields of validation errors.
+var errorFields = []struct {
+	err   error
+	field string
+}{
+	{services.ErrInvalidAlias, "alias"},
+	{services.ErrInvalidExpiry, "expires_at"},
+	{services.ErrInvalidStatus, "redirect_status"},
+	{services.ErrInvalidLogin, "login"},
+	{services.ErrWeakPassword, "password"},
+	{services.ErrInvalidScope, "scopes"},
+}
+
+// error writes a JSON envelope for /api/ routes and a plain text message for others,
+// err is only logged.
+func (s *Server) error(w http.ResponseWriter, r *http.Request, status int, msg string, err error) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = strings.ToLower(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+	}
+	s.writeError(w, r, status, ErrorBody{Code: code, Message: msg}, err)
+}
+
+// serviceError maps a service error to the status by its kind, unknown errors are internal.
+// Only the public message is sent, wrapped causes are logged.
+func (s *Server) serviceError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, kind := range errorKinds {
+		if !errors.Is(err, kind.kind) {
+			continue
+		}
+		msg := services.PublicMessage(err)
+		if msg != err.Error() {
+			s.log(s.context(r)).Warn().Err(err).Msg(msg)
+		}
+		body := ErrorBody{Code: kind.code, Message: msg}
+		for _, field := range errorFields {
+			if errors.Is(err, field.err) {
+				body.Details = append(body.Details, FieldError{Field: field.field, Message: msg})
+			}
+		}
+		s.writeError(w, r, kind.status, body, nil)
+		return
+	}
+	s.internalError(w, r, err)
+}
+
+func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "internal server error", err)
+	}
+	return err != nil
+}
+
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, status int, body ErrorBody, err error) {
+	if err != nil {
+		s.log(s.context(r)).Error().Err(err).Msg(body.Message)
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		w.Header().Set("content-type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(body.Message))
+		return
+	}
+
+	body.CorrelationID, _ = logging.GetCorrelationID(r.Context())
+	response, marshalErr := json.Marshal(ErrorResponse{Error: body})
+	if marshalErr != nil {
+		s.log(s.context(r)).Error().Err(marshalErr).Msg("Can't marshal error")
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(response)
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+const checkDraining = "draining"
+
+var errDraining = errors.New("server is shutting down")
+
+// checkFailedReason replaces errors of dependencies in the response,
+// they may expose hosts and driver messages, so they are only logged.
+const checkFailedReason = "check failed"
+
+// Drain makes readiness fail, so new traffic goes to other instances,
+// the server keeps serving requests until Shutdown.
+func (s *Server) Drain() {
+	atomic.StoreInt32(s.draining, 1)
+}
+
+func (s *Server) isDraining() bool {
+	return atomic.LoadInt32(s.draining) == 1
+}
+
+// healthz reports that the process is alive, it checks no dependencies.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, Health{Status: HealthStatusOK})
+}
+
+// readyz reports whether the server can take traffic with a check per dependency.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.pingTimeout)
+	defer cancel()
+
+	results := s.service.Readiness(ctx)
+	if s.isDraining() {
+		results[checkDraining] = errDraining
+	} else {
+		results[checkDraining] = nil
+	}
+
+	health := Health{Status: HealthStatusOK, Checks: make(map[string]HealthCheck, len(results))}
+	failures := zerolog.Dict()
+	for name, err := range results {
+		check := HealthCheck{Status: HealthStatusOK}
+		if err != nil {
+			reason := checkFailedReason
+			if err == errDraining {
+				reason = err.Error()
+			}
+			check = HealthCheck{Status: HealthStatusFail, Error: reason}
+			health.Status = HealthStatusFail
+			failures.Str(name, err.Error())
+		}
+		health.Checks[name] = check
+	}
+	if health.Status != HealthStatusOK {
+		s.log(r.Context()).Warn().Dict("checks", failures).Msg("Not ready")
+	}
+	writeHealth(w, health)
+}
+
+func writeHealth(w http.ResponseWriter, health Health) {
+	status := http.StatusOK
+	if health.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(health)
+}
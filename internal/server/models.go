@@ -1,7 +1,36 @@
 package server
 
+import (
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// Expiry is an optional link lifetime, either absolute or relative to the request time.
+type Expiry struct {
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int64      `json:"ttl_seconds,omitempty"`
+}
+
+func (e Expiry) Time(now time.Time) (*time.Time, error) {
+	return services.ExpiryTime(e.ExpiresAt, e.TTLSeconds, now)
+}
+
+// LinkOptions define how a link redirects, zero values take the server defaults.
+type LinkOptions struct {
+	// RedirectStatus is 301, 302, 307 or 308
+	RedirectStatus int `json:"redirect_status,omitempty"`
+	// MergeQuery adds the short link query parameters to the URL
+	MergeQuery bool `json:"merge_query,omitempty"`
+	// ForwardPath appends path segments after the key to the URL
+	ForwardPath bool `json:"forward_path,omitempty"`
+}
+
 type Redirect struct {
-	URL string `json:"url"`
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	Expiry
+	LinkOptions
 }
 
 type ResultString struct {
@@ -9,16 +38,104 @@ type ResultString struct {
 }
 
 type URLRow struct {
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 }
 
 type URLRowOriginal struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	Expiry
+	LinkOptions
 }
 
 type URLRowShort struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
 }
+
+type LinkStats struct {
+	ShortURL       string        `json:"short_url"`
+	Total          int64         `json:"total"`
+	UniqueVisitors int64         `json:"unique_visitors"`
+	Bucket         string        `json:"bucket"`
+	Since          time.Time     `json:"since"`
+	Buckets        []StatsBucket `json:"buckets"`
+}
+
+type StatsBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// UserToken is sent as "Authorization: Bearer <token>" to act as the same user.
+type UserToken struct {
+	Token  string `json:"token"`
+	UserID string `json:"user_id"`
+}
+
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+	// MergeAnonymous moves links of the anonymous caller to the account on login
+	MergeAnonymous bool `json:"merge_anonymous,omitempty"`
+}
+
+type Account struct {
+	UserID string `json:"user_id"`
+	Login  string `json:"login"`
+}
+
+type Session struct {
+	UserID    string    `json:"user_id"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	// Key is returned only on creation
+	Key string `json:"key,omitempty"`
+}
+
+// ErrorResponse is the body of failed /api/ requests.
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code          string       `json:"code"`
+	Message       string       `json:"message"`
+	CorrelationID string       `json:"correlation_id,omitempty"`
+	Details       []FieldError `json:"details,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusFail = "fail"
+)
+
+// Health is the body of /healthz and /readyz.
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
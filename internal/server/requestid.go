@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits incoming ids, so they are safe to log and echo.
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// requestIDHandler takes the request id from X-Request-ID or generates one,
+// stores a logger with it as the correlation ID and echoes it in the response.
+func (s *Server) requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		ctx := logging.WithCorrelationID(r.Context(), s.logger, id)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -6,12 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zueve/go-shortener/internal/auth"
+	"github.com/zueve/go-shortener/internal/metrics"
 	"github.com/zueve/go-shortener/internal/services"
 	"github.com/zueve/go-shortener/pkg/logging"
 )
@@ -22,6 +28,16 @@ type Server struct {
 	serverAddress string
 	serviceURL    string
 	pingTimeout   time.Duration
+	tokens        *auth.Signer
+	logger        zerolog.Logger
+	// redirectSampler is shared by requests to log every n-th redirect
+	redirectSampler zerolog.Sampler
+	metrics         *metrics.Metrics
+	tracer          trace.Tracer
+	// draining is shared by copies of the server, it is set once shutdown begins
+	draining *int32
+	// redirectMaxAge is how long browsers cache permanent redirects
+	redirectMaxAge time.Duration
 }
 
 type ServerOption func(*Server) error
@@ -40,19 +56,77 @@ func WithURL(url string) ServerOption {
 	}
 }
 
+// WithLogger sets the base logger of requests.
+func WithLogger(logger zerolog.Logger) ServerOption {
+	return func(h *Server) error {
+		h.logger = logger
+		return nil
+	}
+}
+
+// WithRedirectLogSampling logs only every n-th redirect, errors are always logged.
+func WithRedirectLogSampling(n int) ServerOption {
+	return func(h *Server) error {
+		if n > 1 {
+			h.redirectSampler = &zerolog.BasicSampler{N: uint32(n)}
+		}
+		return nil
+	}
+}
+
+// WithTokenSigner sets keys of user tokens, by default tokens are signed by a random key.
+func WithTokenSigner(signer *auth.Signer) ServerOption {
+	return func(h *Server) error {
+		h.tokens = signer
+		return nil
+	}
+}
+
+// WithMetrics records request metrics and serves them at /metrics.
+func WithMetrics(m *metrics.Metrics) ServerOption {
+	return func(h *Server) error {
+		h.metrics = m
+		return nil
+	}
+}
+
+// WithRedirectMaxAge sets how long browsers cache permanent redirects.
+func WithRedirectMaxAge(maxAge time.Duration) ServerOption {
+	return func(h *Server) error {
+		if maxAge < 0 {
+			return fmt.Errorf("negative redirect max age %s", maxAge)
+		}
+		h.redirectMaxAge = maxAge
+		return nil
+	}
+}
+
+// WithTracerProvider sets the provider of request spans, the global one is used by default.
+func WithTracerProvider(provider trace.TracerProvider) ServerOption {
+	return func(h *Server) error {
+		h.tracer = provider.Tracer(tracerName)
+		return nil
+	}
+}
+
 func New(service services.Service, opts ...ServerOption) (Server, error) {
 	const (
-		defaultServerAddress = ":8080"
-		defaultServiceURL    = "http://localhost:8080"
-		defaultPingTimeout   = 500 * time.Millisecond
+		defaultServerAddress  = ":8080"
+		defaultServiceURL     = "http://localhost:8080"
+		defaultPingTimeout    = 500 * time.Millisecond
+		defaultRedirectMaxAge = 24 * time.Hour
 	)
 
 	s := Server{
-		srv:           nil,
-		service:       service,
-		serverAddress: defaultServerAddress,
-		serviceURL:    defaultServiceURL,
-		pingTimeout:   1 * time.Second,
+		srv:            nil,
+		service:        service,
+		serverAddress:  defaultServerAddress,
+		serviceURL:     defaultServiceURL,
+		pingTimeout:    1 * time.Second,
+		logger:         logging.NewLogger(),
+		tracer:         otel.Tracer(tracerName),
+		draining:       new(int32),
+		redirectMaxAge: defaultRedirectMaxAge,
 	}
 
 	for _, opt := range opts {
@@ -60,17 +134,47 @@ func New(service services.Service, opts ...ServerOption) (Server, error) {
 			return Server{}, err
 		}
 	}
+	if s.tokens == nil {
+		signer, err := auth.NewRandomSigner()
+		if err != nil {
+			return Server{}, err
+		}
+		s.tokens = signer
+	}
 
 	r := chi.NewRouter()
-	r.Use(ungzipHandle)
-	r.Use(gzipHandle)
-	r.Use(setCookieHandler)
-	r.Post("/", s.createRedirect)
-	r.Post("/api/shorten/batch", s.createRedirectByBatch)
-	r.Post("/api/shorten", s.createRedirectJSON)
-	r.Get("/{keyID}", s.redirect)
-	r.Get("/user/urls", s.GetAllUserURLs)
-	r.Get("/ping", s.PingStorage)
+	r.Use(s.requestIDHandler)
+	r.Use(s.tracingHandler)
+	r.Use(s.accessLogHandler)
+	r.Get("/healthz", s.healthz)
+	r.Get("/readyz", s.readyz)
+	if s.metrics != nil {
+		r.Handle("/metrics", s.metrics.Handler())
+	}
+	r.Group(func(r chi.Router) {
+		r.Use(ungzipHandle)
+		r.Use(s.gzipHandle)
+		r.Use(s.setCookieHandler)
+		r.With(s.requireScope(services.ScopeLinksCreate)).Post("/", s.createRedirect)
+		r.With(s.requireScope(services.ScopeLinksCreate)).Post("/api/shorten/batch", s.createRedirectByBatch)
+		r.With(s.requireScope(services.ScopeLinksCreate)).Post("/api/shorten", s.createRedirectJSON)
+		r.Get("/{keyID}", s.redirect)
+		r.Get("/{keyID}/*", s.redirect)
+		r.With(s.requireScope(services.ScopeLinksRead)).Get("/user/urls", s.GetAllUserURLs)
+		r.With(s.requireScope(services.ScopeLinksDelete)).Delete("/api/user/urls", s.deleteUserURLs)
+		r.With(s.requireScope(services.ScopeStatsRead)).Get("/api/links/{keyID}/stats", s.getLinkStats)
+		r.Group(func(r chi.Router) {
+			r.Use(s.requireUser)
+			r.Get("/api/user/token", s.getUserToken)
+			r.Post("/api/user/register", s.register)
+			r.Post("/api/user/login", s.login)
+			r.Post("/api/user/logout", s.logout)
+			r.Post("/api/user/keys", s.createAPIKey)
+			r.Get("/api/user/keys", s.getAPIKeys)
+			r.Delete("/api/user/keys/{apiKeyID}", s.revokeAPIKey)
+		})
+		r.Get("/ping", s.PingStorage)
+	})
 
 	srv := http.Server{
 		Addr:    s.serverAddress,
@@ -81,11 +185,14 @@ func New(service services.Service, opts ...ServerOption) (Server, error) {
 	return s, nil
 }
 
-func (s *Server) ListenAndServe() {
-	s.srv.ListenAndServe()
+// ListenAndServe returns http.ErrServerClosed after Shutdown.
+func (s *Server) ListenAndServe() error {
+	return s.srv.ListenAndServe()
 }
 
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.Drain()
 	return s.srv.Shutdown(ctx)
 }
 
@@ -93,7 +200,7 @@ func (s *Server) createRedirect(w http.ResponseWriter, r *http.Request) {
 	headerContentType := r.Header.Get("Content-Type")
 	userID, err := getUserID(r)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "invalid token", err)
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
 		return
 	}
 
@@ -105,37 +212,37 @@ func (s *Server) createRedirect(w http.ResponseWriter, r *http.Request) {
 	case "application/x-gzip":
 		urlBytes, err := io.ReadAll(r.Body)
 		if err != nil {
-			s.error(s.context(r), w, http.StatusInternalServerError, "invalid body", nil)
+			s.error(w, r, http.StatusInternalServerError, "invalid body", nil)
 			return
 		}
 		url = strings.TrimSuffix(string(urlBytes), "\n")
 	case "text/plain; charset=utf-8":
 		urlBytes, err := io.ReadAll(r.Body)
 		if err != nil {
-			s.error(s.context(r), w, http.StatusInternalServerError, "invalid body", nil)
+			s.error(w, r, http.StatusInternalServerError, "invalid body", nil)
 			return
 		}
 		url = strings.TrimSuffix(string(urlBytes), "\n")
 	default:
-		s.error(s.context(r), w, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
 		return
 	}
 	if url == "" {
-		s.error(s.context(r), w, http.StatusBadRequest, "invalid url", nil)
+		s.error(w, r, http.StatusBadRequest, "invalid url", nil)
 		return
 	}
 
 	w.Header().Set("content-type", "text/plain")
-	s.log(s.context(r)).Info().Msgf("Add url %s", url)
+	s.log(s.context(r)).Info().Str("url", url).Msg("Add url")
 	var existErr *services.LinkExistError
-	key, err := s.service.CreateRedirect(s.context(r), url, userID)
+	key, err := s.service.CreateRedirect(s.context(r), services.Link{URL: url, UserID: userID})
 	if errors.As(err, &existErr) {
 		resultURL := fmt.Sprintf("%s/%s", s.serviceURL, existErr.Key)
 		w.WriteHeader(http.StatusConflict)
 		w.Write([]byte(resultURL))
 		return
 	} else if err != nil {
-		s.internalError(w, r, err)
+		s.serviceError(w, r, err)
 		return
 	}
 	resultURL := fmt.Sprintf("%s/%s", s.serviceURL, key)
@@ -145,20 +252,46 @@ func (s *Server) createRedirect(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) redirect(w http.ResponseWriter, r *http.Request) {
 	key := chi.URLParam(r, "keyID")
-	s.log(s.context(r)).Info().Msgf("Call redirect for %s", key)
-	url, err := s.service.GetURLByKey(s.context(r), key)
+	s.sampledLog(s.context(r), s.redirectSampler).Info().Msgf("Call redirect for %s", key)
+	link, err := s.service.GetRedirect(s.context(r), key)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusBadRequest, "invalid key", err)
+		s.serviceError(w, r, err)
+		return
+	}
+	trailing := chi.URLParam(r, "*")
+	if trailing != "" && !link.ForwardPath {
+		s.serviceError(w, r, services.ErrNotFound)
 		return
 	}
-	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	s.service.RecordClick(s.context(r), services.Click{
+		Key:       key,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	})
+	s.setRedirectCache(w, link, time.Now())
+	http.Redirect(w, r, link.Destination(trailing, r.URL.Query()), link.RedirectStatus)
+}
+
+// setRedirectCache lets browsers cache permanent redirects, but not past the link expiry.
+// Cached redirects skip the server, so their clicks are not recorded.
+func (s *Server) setRedirectCache(w http.ResponseWriter, link services.Link, now time.Time) {
+	if !services.IsPermanentRedirect(link.RedirectStatus) {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		return
+	}
+	maxAge := s.redirectMaxAge
+	if link.ExpiresAt != nil && link.ExpiresAt.Sub(now) < maxAge {
+		maxAge = link.ExpiresAt.Sub(now)
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int64(maxAge/time.Second)))
 }
 
 func (s *Server) createRedirectJSON(w http.ResponseWriter, r *http.Request) {
 	headerContentType := r.Header.Get("Content-Type")
 	userID, err := getUserID(r)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "invalid token", err)
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
 		return
 	}
 
@@ -167,27 +300,40 @@ func (s *Server) createRedirectJSON(w http.ResponseWriter, r *http.Request) {
 	case "application/json":
 		dataBytes, err := io.ReadAll(r.Body)
 		if err != nil {
-			s.error(s.context(r), w, http.StatusInternalServerError, "invalid body", err)
+			s.error(w, r, http.StatusInternalServerError, "invalid body", err)
 			return
 		}
 		err = json.Unmarshal(dataBytes, &redirect)
 		if err != nil || redirect.URL == "" {
-			s.error(s.context(r), w, http.StatusBadRequest, "invalid body", err)
+			s.error(w, r, http.StatusBadRequest, "invalid body", err)
 			return
 		}
 	default:
-		s.error(s.context(r), w, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		return
+	}
+	expiresAt, err := redirect.Expiry.Time(time.Now())
+	if err != nil {
+		s.serviceError(w, r, err)
 		return
 	}
-	s.log(s.context(r)).Info().Msgf("Create redirect for %s", redirect.URL)
+	s.log(s.context(r)).Info().Str("url", redirect.URL).Msg("Create redirect")
 	status := http.StatusCreated
 	var existErr *services.LinkExistError
-	key, err := s.service.CreateRedirect(s.context(r), redirect.URL, userID)
+	key, err := s.service.CreateRedirect(s.context(r), services.Link{
+		Key:            redirect.Alias,
+		URL:            redirect.URL,
+		RedirectStatus: redirect.RedirectStatus,
+		MergeQuery:     redirect.MergeQuery,
+		ForwardPath:    redirect.ForwardPath,
+		UserID:         userID,
+		ExpiresAt:      expiresAt,
+	})
 	if errors.As(err, &existErr) {
 		key = existErr.Key
 		status = http.StatusConflict
 	} else if err != nil {
-		s.internalError(w, r, err)
+		s.serviceError(w, r, err)
 		return
 	}
 	result := ResultString{
@@ -196,7 +342,7 @@ func (s *Server) createRedirectJSON(w http.ResponseWriter, r *http.Request) {
 
 	response, err := json.Marshal(result)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "internal error", err)
+		s.error(w, r, http.StatusInternalServerError, "internal error", err)
 		return
 	}
 	w.Header().Set("content-type", "application/json")
@@ -207,31 +353,30 @@ func (s *Server) createRedirectJSON(w http.ResponseWriter, r *http.Request) {
 func (s *Server) GetAllUserURLs(w http.ResponseWriter, r *http.Request) {
 	userID, err := getUserID(r)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "invalid token", err)
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
 		return
 	}
-	linksMap, err := s.service.GetAllUserURLs(s.context(r), userID)
+	links, err := s.service.GetAllUserURLs(s.context(r), userID)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "internal error", err)
+		s.error(w, r, http.StatusInternalServerError, "internal error", err)
 		return
 	}
 
-	result := make([]URLRow, len(linksMap))
-	i := 0
-	for key, url := range linksMap {
+	result := make([]URLRow, len(links))
+	for i, link := range links {
 		result[i] = URLRow{
-			OriginalURL: url,
-			ShortURL:    fmt.Sprintf("%s/%s", s.serviceURL, key),
+			OriginalURL: link.URL,
+			ShortURL:    fmt.Sprintf("%s/%s", s.serviceURL, link.Key),
+			ExpiresAt:   link.ExpiresAt,
 		}
-		i = i + 1
 	}
 	response, err := json.Marshal(result)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "internal server error", err)
+		s.error(w, r, http.StatusInternalServerError, "internal server error", err)
 		return
 	}
 	status := http.StatusOK
-	if len(linksMap) == 0 {
+	if len(links) == 0 {
 		status = http.StatusNoContent
 	}
 	w.Header().Set("content-type", "application/json")
@@ -239,10 +384,28 @@ func (s *Server) GetAllUserURLs(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(response))
 }
 
+// getUserToken returns the caller's token to use it later as a bearer token.
+func (s *Server) getUserToken(w http.ResponseWriter, r *http.Request) {
+	id, err := getIdentity(r)
+	if err != nil {
+		s.error(w, r, http.StatusInternalServerError, "invalid token", err)
+		return
+	}
+	response, err := json.Marshal(UserToken{Token: id.Token, UserID: id.UserID})
+	if s.internalError(w, r, err) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
 func (s *Server) createRedirectByBatch(w http.ResponseWriter, r *http.Request) {
 	headerContentType := r.Header.Get("Content-Type")
 	if headerContentType != "application/json" {
-		s.error(s.context(r), w, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		return
 	}
 	userID, err := getUserID(r)
 	if s.internalError(w, r, err) {
@@ -256,27 +419,41 @@ func (s *Server) createRedirectByBatch(w http.ResponseWriter, r *http.Request) {
 	requestURLs := make([]URLRowOriginal, 0)
 	err = json.Unmarshal(dataBytes, &requestURLs)
 	if err != nil {
-		s.error(s.context(r), w, http.StatusBadRequest, "invalid body", err)
+		s.error(w, r, http.StatusBadRequest, "invalid body", err)
 		return
 	}
 	// transform request to internal format
 	size := len(requestURLs)
-	urls := make([]string, size)
+	links := make([]services.Link, size)
+	now := time.Now()
 	for i := range requestURLs {
-		urls[i] = requestURLs[i].OriginalURL
+		expiresAt, err := requestURLs[i].Expiry.Time(now)
+		if err != nil {
+			s.serviceError(w, r, err)
+			return
+		}
+		links[i] = services.Link{
+			URL:            requestURLs[i].OriginalURL,
+			UserID:         userID,
+			ExpiresAt:      expiresAt,
+			RedirectStatus: requestURLs[i].RedirectStatus,
+			MergeQuery:     requestURLs[i].MergeQuery,
+			ForwardPath:    requestURLs[i].ForwardPath,
+		}
 	}
 
-	urls, err = s.service.CreateRedirectByBatch(s.context(r), urls, userID)
+	keys, err := s.service.CreateRedirectByBatch(s.context(r), links)
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
 
 	// transform result to responce format
 	responseURLs := make([]URLRowShort, size)
-	if s.internalError(w, r, err) {
-		return
-	}
 	for i := range requestURLs {
 		responseURLs[i] = URLRowShort{
 			CorrelationID: requestURLs[i].CorrelationID,
-			ShortURL:      fmt.Sprintf("%s/%s", s.serviceURL, urls[i]),
+			ShortURL:      fmt.Sprintf("%s/%s", s.serviceURL, keys[i]),
 		}
 	}
 	response, err := json.Marshal(responseURLs)
@@ -292,6 +469,91 @@ func (s *Server) createRedirectByBatch(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(response))
 }
 
+func (s *Server) deleteUserURLs(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != "application/json" {
+		s.error(w, r, http.StatusUnsupportedMediaType, "invalid ContentType", nil)
+		return
+	}
+	userID, err := getUserID(r)
+	if s.internalError(w, r, err) {
+		return
+	}
+	dataBytes, err := io.ReadAll(r.Body)
+	if s.internalError(w, r, err) {
+		return
+	}
+	keys := make([]string, 0)
+	if err := json.Unmarshal(dataBytes, &keys); err != nil {
+		s.error(w, r, http.StatusBadRequest, "invalid body", err)
+		return
+	}
+	s.log(s.context(r)).Info().Msgf("Delete %d urls", len(keys))
+	if err := s.service.DeleteUserURLs(s.context(r), keys, userID); err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// statsBuckets are allowed sizes of stats buckets by the query parameter.
+var statsBuckets = map[string]time.Duration{
+	"hour": time.Hour,
+	"day":  24 * time.Hour,
+}
+
+func (s *Server) getLinkStats(w http.ResponseWriter, r *http.Request) {
+	const defaultStatsPeriod = 30 * 24 * time.Hour
+
+	userID, err := getUserID(r)
+	if s.internalError(w, r, err) {
+		return
+	}
+	key := chi.URLParam(r, "keyID")
+
+	bucketName := r.URL.Query().Get("bucket")
+	if bucketName == "" {
+		bucketName = "day"
+	}
+	bucket, ok := statsBuckets[bucketName]
+	if !ok {
+		s.error(w, r, http.StatusBadRequest, "invalid bucket, use hour or day", nil)
+		return
+	}
+	since := time.Now().Add(-defaultStatsPeriod)
+	if value := r.URL.Query().Get("since"); value != "" {
+		since, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			s.error(w, r, http.StatusBadRequest, "invalid since, use RFC3339", nil)
+			return
+		}
+	}
+
+	stats, err := s.service.GetLinkStats(s.context(r), key, userID, since, bucket)
+	if err != nil {
+		s.serviceError(w, r, err)
+		return
+	}
+
+	result := LinkStats{
+		ShortURL:       fmt.Sprintf("%s/%s", s.serviceURL, key),
+		Total:          stats.Total,
+		UniqueVisitors: stats.UniqueVisitors,
+		Bucket:         bucketName,
+		Since:          since.UTC(),
+		Buckets:        make([]StatsBucket, len(stats.Buckets)),
+	}
+	for i, b := range stats.Buckets {
+		result.Buckets[i] = StatsBucket{Start: b.Start, Clicks: b.Clicks}
+	}
+	response, err := json.Marshal(result)
+	if s.internalError(w, r, err) {
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
 func (s *Server) PingStorage(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), time.Duration(s.pingTimeout))
 	defer cancel()
@@ -305,27 +567,27 @@ func (s *Server) PingStorage(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-func (s *Server) error(ctx context.Context, w http.ResponseWriter, code int, msg string, err error) {
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		s.log(ctx).Error().Err(err).Msg(msg)
-
+		return r.RemoteAddr
 	}
-	w.WriteHeader(code)
-	w.Header().Set("content-type", "text/plain")
-	w.Write([]byte(msg))
-}
-
-func (s *Server) internalError(w http.ResponseWriter, r *http.Request, err error) bool {
-	if err != nil {
-		s.error(s.context(r), w, http.StatusInternalServerError, "internal server error", err)
-	}
-	return err != nil
+	return host
 }
 
 func (s Server) context(r *http.Request) context.Context {
 	return r.Context()
 }
 
+func (s Server) sampledLog(ctx context.Context, sampler zerolog.Sampler) *zerolog.Logger {
+	logger := s.log(ctx)
+	if sampler == nil {
+		return logger
+	}
+	sampled := logger.Sample(sampler)
+	return &sampled
+}
+
 func (s Server) log(ctx context.Context) *zerolog.Logger {
 	_, logger := logging.GetCtxLogger(ctx)
 	logger = logger.With().
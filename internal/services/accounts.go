@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	loginMinLength    = 3
+	loginMaxLength    = 64
+	passwordMinLength = 8
+	// bcrypt ignores bytes after 72
+	passwordMaxLength = 72
+	sessionTokenSize  = 32
+)
+
+var loginPattern = regexp.MustCompile(`^[a-z0-9_.@-]+$`)
+
+// Register creates an account, the login is case insensitive.
+func (s *Service) Register(ctx context.Context, login, password string) (Account, error) {
+	ctx, span := tracer.Start(ctx, "Service.Register")
+	defer span.End()
+
+	login = normalizeLogin(login)
+	if len(login) < loginMinLength || len(login) > loginMaxLength || !loginPattern.MatchString(login) {
+		return Account{}, WithDetail(ErrInvalidLogin, "must be %d to %d of latin letters, digits or _.@-",
+			loginMinLength, loginMaxLength)
+	}
+	if len(password) < passwordMinLength || len(password) > passwordMaxLength {
+		return Account{}, WithDetail(ErrWeakPassword, "length must be from %d to %d", passwordMinLength, passwordMaxLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordCost)
+	if err != nil {
+		return Account{}, err
+	}
+	id, err := uuid.New().MarshalBinary()
+	if err != nil {
+		return Account{}, err
+	}
+	account := Account{
+		ID:           hex.EncodeToString(id),
+		Login:        login,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.storage.AddAccount(ctx, account); err != nil {
+		return Account{}, err
+	}
+	s.log(ctx).Info().Str("user_id", account.ID).Msg("Account registered")
+	return account, nil
+}
+
+// Login checks the password and starts a session, the returned token identifies it.
+// Links of the anonymous user mergeUserID, if set, are moved to the account.
+func (s *Service) Login(ctx context.Context, login, password, mergeUserID string) (string, Session, error) {
+	ctx, span := tracer.Start(ctx, "Service.Login")
+	defer span.End()
+
+	account, err := s.storage.GetAccount(ctx, normalizeLogin(login))
+	if errors.Is(err, ErrAccountNotFound) {
+		return "", Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", Session{}, err
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		s.log(ctx).Warn().Str("user_id", account.ID).Msg("Wrong password")
+		return "", Session{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	if mergeUserID != "" && mergeUserID != account.ID {
+		count, err := s.storage.MoveUserLinks(ctx, mergeUserID, account.ID)
+		if err != nil {
+			return "", Session{}, err
+		}
+		s.log(ctx).Info().Str("user_id", account.ID).Int64("links", count).Msg("Anonymous links merged")
+	}
+
+	token, err := randomHex(sessionTokenSize)
+	if err != nil {
+		return "", Session{}, err
+	}
+	session := Session{
+		ID:        tokenHash(token),
+		UserID:    account.ID,
+		ExpiresAt: time.Now().Add(s.sessionTTL).UTC(),
+	}
+	if err := s.storage.AddSession(ctx, session); err != nil {
+		return "", Session{}, err
+	}
+	s.log(ctx).Info().Str("user_id", account.ID).Msg("Logged in")
+	return token, session, nil
+}
+
+// GetSession returns ErrSessionNotFound for unknown and expired tokens.
+func (s *Service) GetSession(ctx context.Context, token string) (Session, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetSession")
+	defer span.End()
+
+	session, err := s.storage.GetSession(ctx, tokenHash(token))
+	if err != nil {
+		return Session{}, err
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *Service) Logout(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "Service.Logout")
+	defer span.End()
+
+	return s.storage.DeleteSession(ctx, tokenHash(token))
+}
+
+// tokenHash is stored instead of the token, so stored sessions and API keys can't be used to log in.
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeLogin(login string) string {
+	return strings.ToLower(strings.TrimSpace(login))
+}
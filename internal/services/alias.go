@@ -0,0 +1,41 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 64
+)
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// reservedAliases are first path segments used by the service itself.
+var reservedAliases = map[string]struct{}{
+	"api":     {},
+	"user":    {},
+	"ping":    {},
+	"metrics": {},
+	"healthz": {},
+	"readyz":  {},
+}
+
+// ValidateAlias checks that a user chosen key can be used in the short link path.
+// Numeric aliases are not allowed, they are reserved for generated keys.
+func ValidateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return WithDetail(ErrInvalidAlias, "length must be from %d to %d", aliasMinLength, aliasMaxLength)
+	}
+	if !aliasPattern.MatchString(alias) {
+		return WithDetail(ErrInvalidAlias, "only latin letters, digits, '-' and '_' are allowed")
+	}
+	if strings.Trim(alias, "0123456789") == "" {
+		return WithDetail(ErrInvalidAlias, "must not be a number")
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return WithDetail(ErrInvalidAlias, "%s is reserved", alias)
+	}
+	return nil
+}
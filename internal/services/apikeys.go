@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeLinksCreate = "links:create"
+	ScopeLinksRead   = "links:read"
+	ScopeLinksDelete = "links:delete"
+	ScopeStatsRead   = "stats:read"
+
+	// APIKeyPrefix tells API keys from other tokens
+	APIKeyPrefix = "sk_"
+
+	apiKeyIDSize     = 8
+	apiKeyTokenSize  = 32
+	apiKeyNameLength = 64
+)
+
+var scopes = map[string]struct{}{
+	ScopeLinksCreate: {},
+	ScopeLinksRead:   {},
+	ScopeLinksDelete: {},
+	ScopeStatsRead:   {},
+}
+
+// CreateAPIKey makes a key of the user, the returned token is shown only once.
+func (s *Service) CreateAPIKey(ctx context.Context, userID, name string, keyScopes []string) (string, APIKey, error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateAPIKey")
+	defer span.End()
+
+	if len(keyScopes) == 0 {
+		return "", APIKey{}, WithDetail(ErrInvalidScope, "at least one scope is required")
+	}
+	for _, scope := range keyScopes {
+		if _, ok := scopes[scope]; !ok {
+			return "", APIKey{}, WithDetail(ErrInvalidScope, "%s", scope)
+		}
+	}
+	if len(name) > apiKeyNameLength {
+		name = name[:apiKeyNameLength]
+	}
+
+	id, err := randomHex(apiKeyIDSize)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	secret, err := randomHex(apiKeyTokenSize)
+	if err != nil {
+		return "", APIKey{}, err
+	}
+	token := APIKeyPrefix + secret
+	key := APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      tokenHash(token),
+		Scopes:    keyScopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.storage.AddAPIKey(ctx, key); err != nil {
+		return "", APIKey{}, err
+	}
+	s.log(ctx).Info().Str("user_id", userID).Str("api_key_id", key.ID).Strs("scopes", keyScopes).Msg("API key created")
+	return token, key, nil
+}
+
+// GetAPIKey returns the key of the token or ErrAPIKeyNotFound.
+func (s *Service) GetAPIKey(ctx context.Context, token string) (APIKey, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetAPIKey")
+	defer span.End()
+
+	if !strings.HasPrefix(token, APIKeyPrefix) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return s.storage.GetAPIKey(ctx, tokenHash(token))
+}
+
+func (s *Service) GetUserAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetUserAPIKeys")
+	defer span.End()
+
+	return s.storage.GetUserAPIKeys(ctx, userID)
+}
+
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	ctx, span := tracer.Start(ctx, "Service.RevokeAPIKey")
+	defer span.End()
+
+	if err := s.storage.DeleteAPIKey(ctx, userID, id); err != nil {
+		return err
+	}
+	s.log(ctx).Info().Str("user_id", userID).Str("api_key_id", id).Msg("API key revoked")
+	return nil
+}
+
+func randomHex(size int) (string, error) {
+	raw := make([]byte, size)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// clickRecorder buffers clicks and writes them to storage by batches in a background
+// goroutine. Redirects must stay fast, so clicks are dropped when the buffer is full.
+type clickRecorder struct {
+	storage       StorageExpected
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan Click
+	done   chan struct{}
+}
+
+func newClickRecorder(storage StorageExpected, batchSize int, flushInterval time.Duration) *clickRecorder {
+	c := &clickRecorder{
+		storage:       storage,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		timeout:       10 * time.Second,
+		queue:         make(chan Click, batchSize),
+		done:          make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+func (c *clickRecorder) add(ctx context.Context, click Click) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.queue <- click:
+	default:
+		c.log(ctx).Warn().Str("key", click.Key).Msg("Click dropped, buffer is full")
+	}
+}
+
+// close stops accepting clicks and waits until the buffered ones are flushed.
+func (c *clickRecorder) close(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.queue)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running reports whether the recorder accepts and flushes clicks.
+func (c *clickRecorder) running() bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return !c.closed
+}
+
+func (c *clickRecorder) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(c.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Click, 0, c.batchSize)
+	for {
+		select {
+		case click, ok := <-c.queue:
+			if !ok {
+				c.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= c.batchSize {
+				c.flush(batch)
+				batch = make([]Click, 0, c.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				c.flush(batch)
+				batch = make([]Click, 0, c.batchSize)
+			}
+		}
+	}
+}
+
+func (c *clickRecorder) flush(batch []Click) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := c.storage.AddClicks(ctx, batch); err != nil {
+		c.log(ctx).Error().Err(err).Int("clicks", len(batch)).Msg("Can't save clicks")
+	}
+}
+
+func (c *clickRecorder) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "clickRecorder").
+		Str(logging.Layer, "services").
+		Logger()
+
+	return &logger
+}
+
+// AnonymizeIP zeroes the host part of an address: the last octet
+// of IPv4 and the last 80 bits of IPv6. Invalid addresses become empty.
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// deleter collects delete tasks from handlers and passes them
+// to storage by batches in a background goroutine. Failed batches
+// are kept and retried with backoff.
+type deleter struct {
+	storage       StorageExpected
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	maxBackoff    time.Duration
+	closeAttempts int
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan DeleteTask
+	done   chan struct{}
+}
+
+func newDeleter(storage StorageExpected, batchSize int, flushInterval time.Duration) *deleter {
+	d := &deleter{
+		storage:       storage,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		timeout:       10 * time.Second,
+		maxBackoff:    time.Minute,
+		closeAttempts: 3,
+		queue:         make(chan DeleteTask, batchSize),
+		done:          make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// add queues the task without waiting, it fails with ErrDeleteBusy when the queue is full.
+func (d *deleter) add(ctx context.Context, task DeleteTask) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrServiceClosed
+	}
+	select {
+	case d.queue <- task:
+		return nil
+	default:
+		d.log(ctx).Warn().Str("user_id", task.UserID).Msg("Delete task rejected, queue is full")
+		return ErrDeleteBusy
+	}
+}
+
+// close stops accepting new tasks and waits until the queued ones are flushed.
+func (d *deleter) close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running reports whether the deleter accepts and flushes tasks.
+func (d *deleter) running() bool {
+	select {
+	case <-d.done:
+		return false
+	default:
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return !d.closed
+}
+
+func (d *deleter) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.flushInterval)
+	defer ticker.Stop()
+
+	var (
+		batch    = make([]DeleteTask, 0, d.batchSize)
+		failures int
+		retryAt  time.Time
+	)
+	// flush writes the batch unless a retry of the failed one is not due yet
+	flush := func() {
+		if len(batch) == 0 || time.Now().Before(retryAt) {
+			return
+		}
+		if err := d.flush(batch); err != nil {
+			failures++
+			retryAt = time.Now().Add(d.backoff(failures))
+			return
+		}
+		batch = make([]DeleteTask, 0, d.batchSize)
+		failures = 0
+		retryAt = time.Time{}
+	}
+	for {
+		select {
+		case task, ok := <-d.queue:
+			if !ok {
+				d.flushOnClose(batch)
+				return
+			}
+			batch = append(batch, task)
+			if len(batch) >= d.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// backoff doubles the flush interval with every failure up to maxBackoff.
+func (d *deleter) backoff(failures int) time.Duration {
+	delay := d.flushInterval
+	for i := 1; i < failures && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// flushOnClose makes a few attempts to write the last batch before it is dropped.
+func (d *deleter) flushOnClose(batch []DeleteTask) {
+	for attempt := 1; attempt <= d.closeAttempts; attempt++ {
+		if d.flush(batch) == nil {
+			return
+		}
+		if attempt < d.closeAttempts {
+			time.Sleep(d.backoff(attempt))
+		}
+	}
+	d.log(context.Background()).Error().Int("tasks", len(batch)).Msg("Delete tasks dropped on close")
+}
+
+func (d *deleter) flush(batch []DeleteTask) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+	if err := d.storage.Delete(ctx, batch); err != nil {
+		d.log(ctx).Error().Err(err).Int("tasks", len(batch)).Msg("Can't delete links, will retry")
+		return err
+	}
+	d.log(ctx).Debug().Int("tasks", len(batch)).Msg("Links deleted")
+	return nil
+}
+
+func (d *deleter) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "deleter").
+		Str(logging.Layer, "services").
+		Logger()
+
+	return &logger
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyDeleteStorage fails the first deletes and waits for unblock when it is set.
+type flakyDeleteStorage struct {
+	StorageExpected
+	unblock  chan struct{}
+	mu       sync.Mutex
+	failures int
+	deleted  []DeleteTask
+}
+
+func (s *flakyDeleteStorage) Delete(ctx context.Context, tasks []DeleteTask) error {
+	if s.unblock != nil {
+		<-s.unblock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("storage is down")
+	}
+	s.deleted = append(s.deleted, tasks...)
+	return nil
+}
+
+func (s *flakyDeleteStorage) deletedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.deleted)
+}
+
+func TestDeleter_retry(t *testing.T) {
+	storage := &flakyDeleteStorage{failures: 2}
+	d := newDeleter(storage, 10, 10*time.Millisecond)
+	ctx := context.Background()
+
+	assert.Nil(t, d.add(ctx, DeleteTask{UserID: "user", Keys: []string{"1"}}))
+	assert.Eventually(t, func() bool { return storage.deletedCount() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Nil(t, d.close(ctx))
+}
+
+func TestDeleter_queueFull(t *testing.T) {
+	storage := &flakyDeleteStorage{unblock: make(chan struct{})}
+	d := newDeleter(storage, 1, time.Hour)
+	ctx := context.Background()
+
+	// the worker is stuck on the first task, so the one-slot queue is full after three
+	var err error
+	for i := 0; i < 3 && err == nil; i++ {
+		err = d.add(ctx, DeleteTask{UserID: "user", Keys: []string{"1"}})
+	}
+	assert.ErrorIs(t, err, ErrDeleteBusy)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	close(storage.unblock)
+	assert.Nil(t, d.close(ctx))
+}
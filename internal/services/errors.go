@@ -0,0 +1,130 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of errors, every service error matches one of them with errors.Is,
+// so transports can map them to their status codes.
+var (
+	ErrValidation   = errors.New("validation failed")
+	ErrNotFound     = errors.New("not found")
+	ErrGone         = errors.New("gone")
+	ErrConflict     = errors.New("conflict")
+	ErrForbidden    = errors.New("forbidden")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrUnavailable  = errors.New("unavailable")
+)
+
+var (
+	ErrLinkNotFound  = newKindError(ErrNotFound, "link not found")
+	ErrLinkDeleted   = newKindError(ErrGone, "link is deleted")
+	ErrLinkExpired   = newKindError(ErrGone, "link is expired")
+	ErrInvalidExpiry = newKindError(ErrValidation, "expiry must be in the future")
+	ErrServiceClosed = errors.New("service is closed")
+	ErrKeyExists     = newKindError(ErrConflict, "key is already taken")
+	ErrURLExists     = newKindError(ErrConflict, "url is repeated in the batch")
+	ErrInvalidAlias  = newKindError(ErrValidation, "invalid alias")
+	ErrNotOwner      = newKindError(ErrForbidden, "link belongs to another user")
+	ErrInvalidStatus = newKindError(ErrValidation, "redirect status must be 301, 302, 307 or 308")
+	ErrDeleteBusy    = newKindError(ErrUnavailable, "too many pending deletions, retry later")
+
+	ErrLoginExists        = newKindError(ErrConflict, "login is already taken")
+	ErrInvalidLogin       = newKindError(ErrValidation, "invalid login")
+	ErrWeakPassword       = newKindError(ErrValidation, "password is too short")
+	ErrInvalidCredentials = newKindError(ErrUnauthorized, "invalid login or password")
+	ErrAccountNotFound    = newKindError(ErrNotFound, "account not found")
+	ErrSessionNotFound    = newKindError(ErrNotFound, "session not found")
+
+	ErrInvalidScope    = newKindError(ErrValidation, "invalid scope")
+	ErrAPIKeyNotFound  = newKindError(ErrNotFound, "api key not found")
+	ErrScopeNotAllowed = newKindError(ErrForbidden, "api key scope does not allow the operation")
+)
+
+// kinds are checked in order by PublicMessage.
+var kinds = []error{ErrValidation, ErrNotFound, ErrGone, ErrConflict, ErrForbidden, ErrUnauthorized, ErrUnavailable}
+
+// PublicMessage returns the message of the first service error in the chain, causes
+// wrapped by storage such as driver errors are left out, so it is safe to send to clients.
+func PublicMessage(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e := e.(type) {
+		case *detailError:
+			return e.Error()
+		case *kindError:
+			return e.msg
+		case *LinkExistError:
+			return "link already exists with key " + e.Key
+		}
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return kind.Error()
+		}
+	}
+	return "internal error"
+}
+
+// detailError adds details safe to show to clients to a service error.
+type detailError struct {
+	err    error
+	detail string
+}
+
+// WithDetail wraps a service error with a detail, unlike fmt.Errorf
+// the detail is kept in the public message.
+func WithDetail(err error, format string, args ...interface{}) error {
+	return &detailError{err: err, detail: fmt.Sprintf(format, args...)}
+}
+
+func (e *detailError) Error() string {
+	return e.err.Error() + ": " + e.detail
+}
+
+func (e *detailError) Unwrap() error {
+	return e.err
+}
+
+// kindError is a specific error of a kind.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func newKindError(kind error, msg string) error {
+	return &kindError{kind: kind, msg: msg}
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// LinkExistError is returned by storage when the origin URL is already shortened.
+type LinkExistError struct {
+	Key string
+	Err error
+}
+
+func NewLinkExistError(key string, err error) error {
+	return &LinkExistError{
+		Key: key,
+		Err: err,
+	}
+}
+
+func (e *LinkExistError) Error() string {
+	return fmt.Sprintf("link already exists with key %s: %v", e.Key, e.Err)
+}
+
+func (e *LinkExistError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LinkExistError) Is(target error) bool {
+	return target == ErrConflict
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublicMessage(t *testing.T) {
+	driverErr := errors.New(`duplicate key value violates unique constraint "link_origin_url_idx"`)
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"kind", ErrLinkNotFound, "link not found"},
+		{"detail", WithDetail(ErrInvalidAlias, "must not be a number"), "invalid alias: must not be a number"},
+		{"storage cause", fmt.Errorf("%w: %v", ErrKeyExists, driverErr), "key is already taken"},
+		{"existing link", NewLinkExistError("abc", driverErr), "link already exists with key abc"},
+		{"bare kind", fmt.Errorf("%w: %v", ErrConflict, driverErr), "conflict"},
+		{"unknown", driverErr, "internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PublicMessage(tt.err))
+		})
+	}
+}
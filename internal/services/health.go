@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+)
+
+// Names of readiness checks made by the service.
+const (
+	CheckStorage = "storage"
+	CheckWorkers = "workers"
+)
+
+// ReadinessCheck is an additional check of a dependency, it returns nil when it is ready.
+type ReadinessCheck func(ctx context.Context) error
+
+// WithReadinessCheck adds a named check to Readiness.
+func WithReadinessCheck(name string, check ReadinessCheck) ServiceOption {
+	return func(s *Service) {
+		if s.checks == nil {
+			s.checks = make(map[string]ReadinessCheck)
+		}
+		s.checks[name] = check
+	}
+}
+
+// Readiness checks storage, background workers and added checks,
+// the result has an entry per check with nil for passed ones.
+func (s *Service) Readiness(ctx context.Context) map[string]error {
+	result := map[string]error{
+		CheckStorage: s.storage.Ping(ctx),
+		CheckWorkers: s.checkWorkers(),
+	}
+	for name, check := range s.checks {
+		result[name] = check(ctx)
+	}
+	return result
+}
+
+func (s *Service) checkWorkers() error {
+	switch {
+	case !s.deleter.running():
+		return errors.New("deleter is stopped")
+	case !s.clicks.running():
+		return errors.New("click recorder is stopped")
+	case s.sweeper != nil && !s.sweeper.running():
+		return errors.New("sweeper is stopped")
+	}
+	return nil
+}
@@ -2,12 +2,53 @@ package services
 
 import (
 	"context"
+	"time"
 )
 
 type StorageExpected interface {
-	Get(ctx context.Context, key string) (string, error)
-	Add(ctx context.Context, url string, userID string) (string, error)
-	AddByBatch(ctx context.Context, urls []string, userID string) ([]string, error)
-	GetAllUserURLs(ctx context.Context, userID string) (map[string]string, error)
+	Get(ctx context.Context, key string) (Link, error)
+	Add(ctx context.Context, link Link, keyFunc KeyFunc) (string, error)
+	AddByBatch(ctx context.Context, links []Link, keyFunc KeyFunc) ([]string, error)
+	GetAllUserURLs(ctx context.Context, userID string) ([]Link, error)
+	Delete(ctx context.Context, tasks []DeleteTask) error
+	// SweepExpired removes links expired before the moment or only marks them deleted when archive is set.
+	SweepExpired(ctx context.Context, before time.Time, archive bool) (int64, error)
+	AddClicks(ctx context.Context, clicks []Click) error
+	// GetStats aggregates clicks of the key since the moment by buckets of the given size.
+	GetStats(ctx context.Context, key string, since time.Time, bucket time.Duration) (LinkStats, error)
+	// AddAccount fails with ErrLoginExists when the login is taken.
+	AddAccount(ctx context.Context, account Account) error
+	// GetAccount returns ErrAccountNotFound for an unknown login.
+	GetAccount(ctx context.Context, login string) (Account, error)
+	AddSession(ctx context.Context, session Session) error
+	// GetSession returns ErrSessionNotFound for an unknown or deleted session.
+	GetSession(ctx context.Context, id string) (Session, error)
+	DeleteSession(ctx context.Context, id string) error
+	// MoveUserLinks gives all links of one user to another one.
+	MoveUserLinks(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	AddAPIKey(ctx context.Context, key APIKey) error
+	// GetAPIKey finds a key by the token hash, returns ErrAPIKeyNotFound for unknown ones.
+	GetAPIKey(ctx context.Context, hash string) (APIKey, error)
+	GetUserAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	// DeleteAPIKey returns ErrAPIKeyNotFound if the user has no such key.
+	DeleteAPIKey(ctx context.Context, userID, id string) error
 	Ping(ctx context.Context) error
 }
+
+// MetricsExpected receives events of the service for monitoring.
+type MetricsExpected interface {
+	ObserveRedirect(hit bool)
+	// ObserveLinksCreated gets the mode LinkModeSingle or LinkModeBatch.
+	ObserveLinksCreated(mode string, count int, conflict bool)
+}
+
+const (
+	LinkModeSingle = "single"
+	LinkModeBatch  = "batch"
+)
+
+type noMetrics struct{}
+
+func (noMetrics) ObserveRedirect(hit bool) {}
+
+func (noMetrics) ObserveLinksCreated(mode string, count int, conflict bool) {}
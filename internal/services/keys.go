@@ -0,0 +1,171 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	KeyStrategySequential = "sequential"
+	KeyStrategyBase62     = "base62"
+	KeyStrategyRandom     = "random"
+	KeyStrategyObfuscated = "obfuscated"
+)
+
+// base62Alphabet starts with letters, so padded keys never look like legacy numeric keys.
+const base62Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// KeyFunc makes a key for a new link from its storage id.
+type KeyFunc func(id int64) (string, error)
+
+// KeyGenerator is a strategy of short keys generation.
+type KeyGenerator interface {
+	Generate(id int64) (string, error)
+	// Matches reports whether the key has the format of generated keys,
+	// such keys are not allowed as aliases to keep the namespaces apart.
+	Matches(key string) bool
+}
+
+// NewKeyGenerator returns a generator by strategy name. length is used by
+// random keys and as minimal length of base62 keys, secret by obfuscated keys.
+func NewKeyGenerator(strategy string, length int, secret string) (KeyGenerator, error) {
+	switch strategy {
+	case KeyStrategySequential, "":
+		return SequentialKeys{}, nil
+	case KeyStrategyBase62:
+		return Base62Keys{MinLength: length}, nil
+	case KeyStrategyRandom:
+		if length < 1 {
+			return nil, fmt.Errorf("invalid random key length %d", length)
+		}
+		return RandomKeys{Length: length}, nil
+	case KeyStrategyObfuscated:
+		if secret == "" {
+			return nil, errors.New("obfuscated keys require a secret")
+		}
+		return ObfuscatedKeys{Secret: []byte(secret)}, nil
+	default:
+		return nil, fmt.Errorf("unknown key strategy %q", strategy)
+	}
+}
+
+// SequentialKeys uses the storage id as is.
+type SequentialKeys struct{}
+
+func (g SequentialKeys) Generate(id int64) (string, error) {
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (g SequentialKeys) Matches(key string) bool {
+	return strings.Trim(key, "0123456789") == ""
+}
+
+// Base62Keys encodes the storage id, keys are short but still sequential.
+type Base62Keys struct {
+	MinLength int
+}
+
+func (g Base62Keys) Generate(id int64) (string, error) {
+	return encodeBase62(uint64(id), g.MinLength), nil
+}
+
+func (g Base62Keys) Matches(key string) bool {
+	return len(key) >= g.MinLength && isBase62(key)
+}
+
+// RandomKeys ignores the storage id, collisions are resolved by the service with retries.
+type RandomKeys struct {
+	Length int
+}
+
+func (g RandomKeys) Generate(id int64) (string, error) {
+	max := big.NewInt(int64(len(base62Alphabet)))
+	key := make([]byte, g.Length)
+	for {
+		for i := range key {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			key[i] = base62Alphabet[n.Int64()]
+		}
+		// numeric keys are reserved for ids
+		if strings.Trim(string(key), "0123456789") != "" {
+			return string(key), nil
+		}
+	}
+}
+
+func (g RandomKeys) Matches(key string) bool {
+	return len(key) == g.Length && isBase62(key)
+}
+
+// ObfuscatedKeys permutes the storage id with a Feistel network keyed by
+// the secret, so keys of neighbour ids are unrelated and can't be predicted
+// without the secret. Ids are limited to 40 bits, keys always have 7 chars.
+type ObfuscatedKeys struct {
+	Secret []byte
+}
+
+const (
+	obfuscatedLength = 7
+	obfuscatedRounds = 4
+	// obfuscatedHalfBits is a half of the permuted id, 62^7 covers all 40 bit values
+	obfuscatedHalfBits        = 20
+	obfuscatedHalfMask uint64 = 1<<obfuscatedHalfBits - 1
+	obfuscatedMaxID           = 1<<(2*obfuscatedHalfBits) - 1
+)
+
+func (g ObfuscatedKeys) Generate(id int64) (string, error) {
+	if id < 0 || id > obfuscatedMaxID {
+		return "", fmt.Errorf("id %d is out of obfuscated keys range", id)
+	}
+	left, right := uint64(id)>>obfuscatedHalfBits, uint64(id)&obfuscatedHalfMask
+	for round := byte(0); round < obfuscatedRounds; round++ {
+		left, right = right, left^g.round(round, right)
+	}
+	return encodeBase62(left<<obfuscatedHalfBits|right, obfuscatedLength), nil
+}
+
+func (g ObfuscatedKeys) Matches(key string) bool {
+	return len(key) == obfuscatedLength && isBase62(key)
+}
+
+// round is the keyed round function of the Feistel network.
+func (g ObfuscatedKeys) round(round byte, half uint64) uint64 {
+	h := hmac.New(sha256.New, g.Secret)
+	h.Write([]byte{round, byte(half >> 16), byte(half >> 8), byte(half)})
+	sum := h.Sum(nil)
+	return (uint64(sum[0])<<16 | uint64(sum[1])<<8 | uint64(sum[2])) & obfuscatedHalfMask
+}
+
+func isBase62(key string) bool {
+	for i := range key {
+		if strings.IndexByte(base62Alphabet, key[i]) < 0 {
+			return false
+		}
+	}
+	return key != ""
+}
+
+func encodeBase62(n uint64, minLength int) string {
+	base := uint64(len(base62Alphabet))
+	key := make([]byte, 0, 11)
+	for n > 0 {
+		key = append(key, base62Alphabet[n%base])
+		n = n / base
+	}
+	for len(key) < minLength || len(key) == 0 {
+		key = append(key, base62Alphabet[0])
+	}
+	for i, j := 0, len(key)-1; i < j; i, j = i+1, j-1 {
+		key[i], key[j] = key[j], key[i]
+	}
+	return string(key)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyGenerators(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		id       int64
+		key      string
+	}{
+		{name: "sequential", strategy: KeyStrategySequential, id: 62, key: "62"},
+		{name: "base62", strategy: KeyStrategyBase62, id: 62, key: "aaaaaaba"},
+		{name: "base62 zero", strategy: KeyStrategyBase62, id: 0, key: "aaaaaaaa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gen, err := NewKeyGenerator(tt.strategy, 8, "")
+			assert.Nil(t, err)
+			key, err := gen.Generate(tt.id)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	_, err := NewKeyGenerator("unknown", 8, "")
+	assert.NotNil(t, err)
+	_, err = NewKeyGenerator(KeyStrategyObfuscated, 8, "")
+	assert.NotNil(t, err, "obfuscated keys require a secret")
+}
+
+func TestRandomKeys(t *testing.T) {
+	gen := RandomKeys{Length: 8}
+	key, err := gen.Generate(1)
+	assert.Nil(t, err)
+	assert.Len(t, key, 8)
+	assert.NotEqual(t, "", strings.Trim(key, "0123456789"))
+}
+
+func TestObfuscatedKeys(t *testing.T) {
+	gen := ObfuscatedKeys{Secret: []byte("secret")}
+	other := ObfuscatedKeys{Secret: []byte("other secret")}
+	seen := make(map[string]struct{})
+	same := 0
+	for id := int64(1); id < 1000; id++ {
+		key, err := gen.Generate(id)
+		assert.Nil(t, err)
+		assert.True(t, gen.Matches(key))
+		_, ok := seen[key]
+		assert.False(t, ok, "keys must be unique")
+		seen[key] = struct{}{}
+
+		otherKey, err := other.Generate(id)
+		assert.Nil(t, err)
+		if key == otherKey {
+			same++
+		}
+	}
+	assert.Less(t, same, 10, "keys must depend on the secret")
+
+	key, err := gen.Generate(obfuscatedMaxID)
+	assert.Nil(t, err)
+	assert.Len(t, key, obfuscatedLength)
+	_, err = gen.Generate(obfuscatedMaxID + 1)
+	assert.NotNil(t, err)
+}
+
+func TestKeyGenerators_Matches(t *testing.T) {
+	tests := []struct {
+		name    string
+		gen     KeyGenerator
+		key     string
+		matches bool
+	}{
+		{name: "sequential number", gen: SequentialKeys{}, key: "42", matches: true},
+		{name: "sequential alias", gen: SequentialKeys{}, key: "sale", matches: false},
+		{name: "base62 long", gen: Base62Keys{MinLength: 4}, key: "summer", matches: true},
+		{name: "base62 short", gen: Base62Keys{MinLength: 8}, key: "summer", matches: false},
+		{name: "random same length", gen: RandomKeys{Length: 6}, key: "summer", matches: true},
+		{name: "random with dash", gen: RandomKeys{Length: 6}, key: "sum-er", matches: false},
+		{name: "obfuscated same length", gen: ObfuscatedKeys{Secret: []byte("secret")}, key: "summer1", matches: true},
+		{name: "obfuscated other length", gen: ObfuscatedKeys{Secret: []byte("secret")}, key: "summer", matches: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.matches, tt.gen.Matches(tt.key))
+		})
+	}
+}
+
+func TestService_aliasOfGeneratedKey(t *testing.T) {
+	s := New(nil, WithKeyGenerator(RandomKeys{Length: 6}))
+	defer s.Close(context.Background())
+
+	_, err := s.CreateRedirect(context.Background(), Link{Key: "summer", URL: "http://example.com", UserID: "user"})
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+	assert.Equal(t, "invalid alias: must not look like a generated key", PublicMessage(err))
+}
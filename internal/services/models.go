@@ -0,0 +1,163 @@
+package services
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// RedirectStatuses are status codes a link can redirect with.
+var RedirectStatuses = map[int]struct{}{
+	http.StatusMovedPermanently:  {},
+	http.StatusFound:             {},
+	http.StatusTemporaryRedirect: {},
+	http.StatusPermanentRedirect: {},
+}
+
+// IsPermanentRedirect reports whether browsers may cache the redirect status.
+func IsPermanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// Link is a short link. On creation storage makes the key from the link id when Key is empty.
+type Link struct {
+	Key       string
+	URL       string
+	UserID    string
+	ExpiresAt *time.Time
+	// RedirectStatus is one of RedirectStatuses, zero takes the service default on creation
+	RedirectStatus int
+	// MergeQuery adds query parameters of the short link request to the URL
+	MergeQuery bool
+	// ForwardPath appends path segments after the key to the URL path
+	ForwardPath bool
+}
+
+// Destination builds the redirect URL for a request of the short link with the trailing path and query.
+// The link URL is kept as is, incoming parameters it already has are skipped and others are appended.
+func (l Link) Destination(trailing string, query url.Values) string {
+	forward := l.ForwardPath && trailing != ""
+	merge := l.MergeQuery && len(query) > 0
+	if !forward && !merge {
+		return l.URL
+	}
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return l.URL
+	}
+	if forward {
+		// cleaning from the root keeps ".." inside the link path
+		extra := path.Clean("/" + trailing)
+		if strings.HasSuffix(trailing, "/") && extra != "/" {
+			extra += "/"
+		}
+		// the escaped path is set too, so escapes of the link path are not normalized
+		rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + (&url.URL{Path: extra}).EscapedPath()
+		u.Path = strings.TrimSuffix(u.Path, "/") + extra
+		u.RawPath = rawPath
+	}
+	if merge {
+		existing := u.Query()
+		extra := make(url.Values, len(query))
+		for name, v := range query {
+			if _, ok := existing[name]; !ok {
+				extra[name] = v
+			}
+		}
+		switch {
+		case len(extra) == 0:
+		case u.RawQuery == "":
+			u.RawQuery = extra.Encode()
+		default:
+			u.RawQuery += "&" + extra.Encode()
+		}
+	}
+	return u.String()
+}
+
+// ExpiryTime converts optional absolute expiry or ttl counted from now to the link expiry.
+func ExpiryTime(expiresAt *time.Time, ttlSeconds int64, now time.Time) (*time.Time, error) {
+	switch {
+	case expiresAt != nil && ttlSeconds != 0:
+		return nil, WithDetail(ErrInvalidExpiry, "expires_at and ttl_seconds are mutually exclusive")
+	case ttlSeconds < 0:
+		return nil, WithDetail(ErrInvalidExpiry, "ttl_seconds must be positive")
+	case ttlSeconds > 0:
+		at := now.Add(time.Duration(ttlSeconds) * time.Second)
+		return &at, nil
+	default:
+		return expiresAt, nil
+	}
+}
+
+// IsExpired reports whether the link is expired at the moment.
+func (l Link) IsExpired(now time.Time) bool {
+	return l.ExpiresAt != nil && !now.Before(*l.ExpiresAt)
+}
+
+// DeleteTask is a request of a user to delete own links by keys.
+type DeleteTask struct {
+	UserID string
+	Keys   []string
+}
+
+// Click is a single redirect of a visitor by a short link.
+type Click struct {
+	Key       string
+	At        time.Time
+	Referrer  string
+	UserAgent string
+	// IP is anonymised before it reaches storage
+	IP string
+}
+
+// StatsBucket is a number of clicks in a period starting at Start.
+type StatsBucket struct {
+	Start  time.Time
+	Clicks int64
+}
+
+// LinkStats is aggregated clicks of a link since some moment.
+type LinkStats struct {
+	Key            string
+	Total          int64
+	UniqueVisitors int64
+	Buckets        []StatsBucket
+}
+
+// Account is a registered user, ID is used as UserID of its links.
+type Account struct {
+	ID           string
+	Login        string
+	PasswordHash string
+	CreatedAt    time.Time
+}
+
+// Session is a login of an account, ID is a hash of the session token.
+type Session struct {
+	ID        string
+	UserID    string
+	ExpiresAt time.Time
+}
+
+// APIKey gives limited access to links of a user, Hash is a hash of the key token.
+type APIKey struct {
+	ID        string
+	UserID    string
+	Name      string
+	Hash      string
+	Scopes    []string
+	CreatedAt time.Time
+}
+
+// HasScope reports whether the key allows the scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLink_Destination(t *testing.T) {
+	tests := []struct {
+		name     string
+		link     Link
+		trailing string
+		query    string
+		expected string
+	}{
+		{
+			name:     "options off",
+			link:     Link{URL: "https://docs.example.com"},
+			trailing: "v2/install",
+			query:    "utm_source=x",
+			expected: "https://docs.example.com",
+		},
+		{
+			name:     "forward path",
+			link:     Link{URL: "https://docs.example.com/", ForwardPath: true},
+			trailing: "v2/install",
+			expected: "https://docs.example.com/v2/install",
+		},
+		{
+			name:     "forward path stays inside link path",
+			link:     Link{URL: "https://docs.example.com/docs", ForwardPath: true},
+			trailing: "../../admin/",
+			expected: "https://docs.example.com/docs/admin/",
+		},
+		{
+			name:     "merge query keeps link parameters",
+			link:     Link{URL: "https://example.com/?ref=short&utm_source=link", MergeQuery: true},
+			query:    "utm_source=x&utm_medium=mail",
+			expected: "https://example.com/?ref=short&utm_source=link&utm_medium=mail",
+		},
+		{
+			name:     "merge query keeps link query unsorted and escaped",
+			link:     Link{URL: "https://example.com/a%2Fb?b=1&a=%2Fx&sig=AbC%3D", MergeQuery: true, ForwardPath: true},
+			trailing: "c",
+			query:    "utm_source=x&b=2",
+			expected: "https://example.com/a%2Fb/c?b=1&a=%2Fx&sig=AbC%3D&utm_source=x",
+		},
+		{
+			name:     "both",
+			link:     Link{URL: "https://docs.example.com", MergeQuery: true, ForwardPath: true},
+			trailing: "v2",
+			query:    "lang=en",
+			expected: "https://docs.example.com/v2?lang=en",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, tt.link.Destination(tt.trailing, query))
+		})
+	}
+}
@@ -1,34 +1,338 @@
 package services
 
-import "context"
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
 
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// tracer makes spans of service methods with the global tracer provider.
+var tracer = otel.Tracer("github.com/zueve/go-shortener/internal/services")
 
 type Service struct {
-	storage StorageExpected
+	storage             StorageExpected
+	keys                KeyGenerator
+	keyAttempts         int
+	deleter             *deleter
+	deleteBatchSize     int
+	deleteFlushInterval time.Duration
+	sweeper             *sweeper
+	sweepInterval       time.Duration
+	sweepArchive        bool
+	clicks              *clickRecorder
+	clickBatchSize      int
+	clickFlushInterval  time.Duration
+	sessionTTL          time.Duration
+	passwordCost        int
+	metrics             MetricsExpected
+	checks              map[string]ReadinessCheck
+	redirectStatus      int
+}
+
+type ServiceOption func(*Service)
+
+// WithDeleteBatch sets how many delete tasks are collected before
+// they are passed to storage and how long to wait for a batch to fill.
+func WithDeleteBatch(size int, flushInterval time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.deleteBatchSize = size
+		s.deleteFlushInterval = flushInterval
+	}
+}
+
+// WithExpiredSweep enables periodic removal of expired links,
+// with archive they are only marked deleted.
+func WithExpiredSweep(interval time.Duration, archive bool) ServiceOption {
+	return func(s *Service) {
+		s.sweepInterval = interval
+		s.sweepArchive = archive
+	}
+}
+
+// WithClickBatch sets how many clicks are buffered before they are passed to storage
+// and how long to wait for a batch to fill. Clicks over the buffer are dropped.
+func WithClickBatch(size int, flushInterval time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.clickBatchSize = size
+		s.clickFlushInterval = flushInterval
+	}
+}
+
+// WithKeyGenerator sets the strategy of keys for links created without alias.
+func WithKeyGenerator(keys KeyGenerator) ServiceOption {
+	return func(s *Service) {
+		s.keys = keys
+	}
+}
+
+// WithSessionTTL sets how long a login session lasts.
+func WithSessionTTL(ttl time.Duration) ServiceOption {
+	return func(s *Service) {
+		s.sessionTTL = ttl
+	}
+}
+
+// WithPasswordCost sets the bcrypt cost of password hashes.
+func WithPasswordCost(cost int) ServiceOption {
+	return func(s *Service) {
+		s.passwordCost = cost
+	}
+}
+
+// WithRedirectStatus sets the status of links created without one, it must be one of RedirectStatuses.
+func WithRedirectStatus(status int) ServiceOption {
+	return func(s *Service) {
+		s.redirectStatus = status
+	}
 }
 
-func New(storage StorageExpected) Service {
-	return Service{
-		storage: storage,
+// WithMetrics sets the receiver of redirect and link creation events.
+func WithMetrics(metrics MetricsExpected) ServiceOption {
+	return func(s *Service) {
+		s.metrics = metrics
 	}
 }
 
-func (s *Service) CreateRedirect(ctx context.Context, key string, userID string) (string, error) {
-	return s.storage.Add(ctx, key, userID)
+func New(storage StorageExpected, opts ...ServiceOption) Service {
+	const (
+		defaultKeyAttempts         = 5
+		defaultDeleteBatchSize     = 100
+		defaultDeleteFlushInterval = time.Second
+		defaultClickBatchSize      = 1000
+		defaultClickFlushInterval  = time.Second
+		defaultSessionTTL          = 30 * 24 * time.Hour
+	)
+
+	s := Service{
+		storage:             storage,
+		keys:                SequentialKeys{},
+		keyAttempts:         defaultKeyAttempts,
+		deleteBatchSize:     defaultDeleteBatchSize,
+		deleteFlushInterval: defaultDeleteFlushInterval,
+		clickBatchSize:      defaultClickBatchSize,
+		clickFlushInterval:  defaultClickFlushInterval,
+		sessionTTL:          defaultSessionTTL,
+		passwordCost:        bcrypt.DefaultCost,
+		metrics:             noMetrics{},
+		redirectStatus:      http.StatusTemporaryRedirect,
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	s.deleter = newDeleter(storage, s.deleteBatchSize, s.deleteFlushInterval)
+	s.clicks = newClickRecorder(storage, s.clickBatchSize, s.clickFlushInterval)
+	if s.sweepInterval > 0 {
+		s.sweeper = newSweeper(storage, s.sweepInterval, s.sweepArchive)
+	}
+
+	return s
+}
+
+// CreateRedirect creates a short link, link.Key is an optional alias chosen by user.
+func (s *Service) CreateRedirect(ctx context.Context, link Link) (string, error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateRedirect")
+	defer span.End()
+
+	link, err := s.prepareLink(link, time.Now())
+	if err != nil {
+		return "", err
+	}
+	var key string
+	err = s.withKeyRetry(link.Key == "", func() (err error) {
+		key, err = s.storage.Add(ctx, link, s.keys.Generate)
+		return err
+	})
+	if err == nil {
+		s.log(ctx).Debug().Str("key", key).Str("user_id", link.UserID).Msg("Link created")
+	}
+	s.observeLinksCreated(LinkModeSingle, 1, err)
+	return key, err
 }
 
 func (s *Service) GetURLByKey(ctx context.Context, key string) (string, error) {
-	return s.storage.Get(ctx, key)
+	link, err := s.GetRedirect(ctx, key)
+	return link.URL, err
+}
+
+// GetRedirect returns an active link by the key.
+func (s *Service) GetRedirect(ctx context.Context, key string) (Link, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetRedirect")
+	defer span.End()
+
+	link, err := s.storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone) {
+			s.metrics.ObserveRedirect(false)
+		}
+		return Link{}, err
+	}
+	if link.IsExpired(time.Now()) {
+		s.metrics.ObserveRedirect(false)
+		return Link{}, ErrLinkExpired
+	}
+	s.metrics.ObserveRedirect(true)
+	if link.RedirectStatus == 0 {
+		// links stored before statuses were configurable
+		link.RedirectStatus = http.StatusTemporaryRedirect
+	}
+	return link, nil
 }
 
-func (s *Service) GetAllUserURLs(ctx context.Context, userID string) (map[string]string, error) {
+func (s *Service) GetAllUserURLs(ctx context.Context, userID string) ([]Link, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetAllUserURLs")
+	defer span.End()
+
 	return s.storage.GetAllUserURLs(ctx, userID)
 }
 
 func (s *Service) Ping(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Service.Ping")
+	defer span.End()
+
 	return s.storage.Ping(ctx)
 }
 
-func (s *Service) CreateRedirectByBatch(ctx context.Context, urls []string, userID string) ([]string, error) {
-	return s.storage.AddByBatch(ctx, urls, userID)
+func (s *Service) CreateRedirectByBatch(ctx context.Context, links []Link) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "Service.CreateRedirectByBatch")
+	defer span.End()
+
+	now := time.Now()
+	prepared := make([]Link, len(links))
+	for i := range links {
+		link, err := s.prepareLink(links[i], now)
+		if err != nil {
+			return nil, err
+		}
+		prepared[i] = link
+	}
+	var keys []string
+	err := s.withKeyRetry(true, func() (err error) {
+		keys, err = s.storage.AddByBatch(ctx, prepared, s.keys.Generate)
+		return err
+	})
+	if err == nil {
+		s.log(ctx).Debug().Int("links", len(keys)).Msg("Links created by batch")
+	}
+	s.observeLinksCreated(LinkModeBatch, len(keys), err)
+	return keys, err
+}
+
+// observeLinksCreated counts created links and conflicts with existing ones,
+// other errors are not counted.
+func (s *Service) observeLinksCreated(mode string, count int, err error) {
+	switch {
+	case err == nil:
+		s.metrics.ObserveLinksCreated(mode, count, false)
+	case errors.Is(err, ErrConflict):
+		s.metrics.ObserveLinksCreated(mode, 0, true)
+	}
+}
+
+// prepareLink validates a new link and fills defaults.
+func (s *Service) prepareLink(link Link, now time.Time) (Link, error) {
+	if link.Key != "" {
+		if err := ValidateAlias(link.Key); err != nil {
+			return Link{}, err
+		}
+		if s.keys.Matches(link.Key) {
+			return Link{}, WithDetail(ErrInvalidAlias, "must not look like a generated key")
+		}
+	}
+	if link.IsExpired(now) {
+		return Link{}, ErrInvalidExpiry
+	}
+	if link.RedirectStatus == 0 {
+		link.RedirectStatus = s.redirectStatus
+	}
+	if _, ok := RedirectStatuses[link.RedirectStatus]; !ok {
+		return Link{}, ErrInvalidStatus
+	}
+	return link, nil
+}
+
+// withKeyRetry repeats add when a generated key collides with an existing one.
+func (s *Service) withKeyRetry(generated bool, add func() error) error {
+	var err error
+	for attempt := 0; attempt < s.keyAttempts; attempt++ {
+		err = add()
+		if !generated || !errors.Is(err, ErrKeyExists) {
+			return err
+		}
+	}
+	return err
+}
+
+// RecordClick registers a redirect in background, it never blocks the caller.
+func (s *Service) RecordClick(ctx context.Context, click Click) {
+	click.IP = AnonymizeIP(click.IP)
+	if click.At.IsZero() {
+		click.At = time.Now()
+	}
+	s.clicks.add(ctx, click)
+}
+
+// GetLinkStats returns clicks statistics of a link, only the owner can see it.
+func (s *Service) GetLinkStats(ctx context.Context, key string, userID string, since time.Time, bucket time.Duration) (LinkStats, error) {
+	ctx, span := tracer.Start(ctx, "Service.GetLinkStats")
+	defer span.End()
+
+	link, err := s.storage.Get(ctx, key)
+	if err != nil {
+		return LinkStats{}, err
+	}
+	if link.UserID != userID {
+		return LinkStats{}, ErrNotOwner
+	}
+	return s.storage.GetStats(ctx, key, since, bucket)
+}
+
+// DeleteUserURLs schedules deletion of user links, links of other users are skipped.
+func (s *Service) DeleteUserURLs(ctx context.Context, keys []string, userID string) error {
+	ctx, span := tracer.Start(ctx, "Service.DeleteUserURLs")
+	defer span.End()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	s.log(ctx).Debug().Int("keys", len(keys)).Str("user_id", userID).Msg("Links deletion scheduled")
+	return s.deleter.add(ctx, DeleteTask{UserID: userID, Keys: keys})
+}
+
+// Close stops background workers and waits for scheduled work to be done.
+// Every worker is stopped even if another one fails, the first error is returned.
+func (s *Service) Close(ctx context.Context) error {
+	var result error
+	stop := func(name string, close func(context.Context) error) {
+		if err := close(ctx); err != nil {
+			s.log(ctx).Error().Err(err).Str("worker", name).Msg("Can't stop worker")
+			if result == nil {
+				result = err
+			}
+			return
+		}
+		s.log(ctx).Info().Str("worker", name).Msg("Worker stopped")
+	}
+	if s.sweeper != nil {
+		stop("sweeper", s.sweeper.close)
+	}
+	stop("clicks", s.clicks.close)
+	stop("deleter", s.deleter.close)
+	return result
+}
+
+func (s *Service) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "Service").
+		Str(logging.Layer, "services").
+		Logger()
+
+	return &logger
 }
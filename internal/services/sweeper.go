@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/zueve/go-shortener/pkg/logging"
+)
+
+// sweeper periodically removes or archives expired links in a background goroutine.
+type sweeper struct {
+	storage  StorageExpected
+	interval time.Duration
+	archive  bool
+	timeout  time.Duration
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newSweeper(storage StorageExpected, interval time.Duration, archive bool) *sweeper {
+	s := &sweeper{
+		storage:  storage,
+		interval: interval,
+		archive:  archive,
+		timeout:  time.Minute,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// close stops the sweeper and waits for the running sweep.
+func (s *sweeper) close(ctx context.Context) error {
+	s.once.Do(func() { close(s.stop) })
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running reports whether the sweeper is not stopped.
+func (s *sweeper) running() bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-s.done:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *sweeper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.sweep()
+		}
+	}
+}
+
+func (s *sweeper) sweep() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	count, err := s.storage.SweepExpired(ctx, time.Now(), s.archive)
+	if err != nil {
+		s.log(ctx).Error().Err(err).Msg("Can't sweep expired links")
+		return
+	}
+	if count > 0 {
+		s.log(ctx).Info().Int64("links", count).Bool("archive", s.archive).Msg("Expired links swept")
+	}
+}
+
+func (s *sweeper) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "sweeper").
+		Str(logging.Layer, "services").
+		Logger()
+
+	return &logger
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+type AccountRow struct {
+	ID           string    `db:"id" json:"id"`
+	Login        string    `db:"login" json:"login"`
+	PasswordHash string    `db:"password_hash" json:"password_hash"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+func (r AccountRow) account() services.Account {
+	return services.Account{
+		ID:           r.ID,
+		Login:        r.Login,
+		PasswordHash: r.PasswordHash,
+		CreatedAt:    r.CreatedAt,
+	}
+}
+
+func newAccountRow(account services.Account) AccountRow {
+	return AccountRow{
+		ID:           account.ID,
+		Login:        account.Login,
+		PasswordHash: account.PasswordHash,
+		CreatedAt:    account.CreatedAt.UTC(),
+	}
+}
+
+type SessionRow struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+	// IsDeleted marks a logged out session in the file storage log
+	IsDeleted bool `db:"-" json:"is_deleted,omitempty"`
+}
+
+func (r SessionRow) session() services.Session {
+	return services.Session{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		ExpiresAt: r.ExpiresAt,
+	}
+}
+
+func newSessionRow(session services.Session) SessionRow {
+	return SessionRow{
+		ID:        session.ID,
+		UserID:    session.UserID,
+		ExpiresAt: session.ExpiresAt.UTC(),
+	}
+}
+
+func (c *Storage) AddAccount(ctx context.Context, account services.Account) error {
+	_, err := c.db.NamedExecContext(ctx,
+		"INSERT INTO account(id, login, password_hash, created_at) VALUES(:id, :login, :password_hash, :created_at)",
+		newAccountRow(account),
+	)
+	if isUniqueViolation(err) {
+		return services.ErrLoginExists
+	}
+	return err
+}
+
+func (c *Storage) GetAccount(ctx context.Context, login string) (services.Account, error) {
+	var row AccountRow
+	err := c.db.GetContext(ctx, &row, "SELECT * FROM account WHERE login=$1", login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.Account{}, services.ErrAccountNotFound
+	} else if err != nil {
+		return services.Account{}, err
+	}
+	return row.account(), nil
+}
+
+func (c *Storage) AddSession(ctx context.Context, session services.Session) error {
+	_, err := c.db.NamedExecContext(ctx,
+		"INSERT INTO account_session(id, user_id, expires_at) VALUES(:id, :user_id, :expires_at)",
+		newSessionRow(session),
+	)
+	return err
+}
+
+func (c *Storage) GetSession(ctx context.Context, id string) (services.Session, error) {
+	var row SessionRow
+	err := c.db.GetContext(ctx, &row, "SELECT * FROM account_session WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.Session{}, services.ErrSessionNotFound
+	} else if err != nil {
+		return services.Session{}, err
+	}
+	return row.session(), nil
+}
+
+func (c *Storage) DeleteSession(ctx context.Context, id string) error {
+	_, err := c.db.ExecContext(ctx, "DELETE FROM account_session WHERE id=$1", id)
+	return err
+}
+
+func (c *Storage) MoveUserLinks(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	result, err := c.db.ExecContext(ctx, "UPDATE link SET user_id=$1 WHERE user_id=$2", toUserID, fromUserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *MemoryStorage) AddAccount(ctx context.Context, account services.Account) error {
+	return c.addAccount(newAccountRow(account), nil)
+}
+
+func (c *MemoryStorage) GetAccount(ctx context.Context, login string) (services.Account, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	row, ok := c.accounts[login]
+	if !ok {
+		return services.Account{}, services.ErrAccountNotFound
+	}
+	return row.account(), nil
+}
+
+func (c *MemoryStorage) AddSession(ctx context.Context, session services.Session) error {
+	return c.putSession(newSessionRow(session), nil)
+}
+
+func (c *MemoryStorage) GetSession(ctx context.Context, id string) (services.Session, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	row, ok := c.sessions[id]
+	if !ok {
+		return services.Session{}, services.ErrSessionNotFound
+	}
+	return row.session(), nil
+}
+
+func (c *MemoryStorage) DeleteSession(ctx context.Context, id string) error {
+	return c.putSession(SessionRow{ID: id, IsDeleted: true}, nil)
+}
+
+func (c *MemoryStorage) MoveUserLinks(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	return c.moveLinks(fromUserID, toUserID, nil)
+}
+
+// addAccount calls persist for a new account and only then makes it visible.
+func (c *MemoryStorage) addAccount(row AccountRow, persist func(AccountRow) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.accounts[row.Login]; ok {
+		return services.ErrLoginExists
+	}
+	if persist != nil {
+		if err := persist(row); err != nil {
+			return err
+		}
+	}
+	c.accounts[row.Login] = row
+	return nil
+}
+
+// putSession adds or, with IsDeleted, removes a session after persist.
+func (c *MemoryStorage) putSession(row SessionRow, persist func(SessionRow) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if persist != nil {
+		if err := persist(row); err != nil {
+			return err
+		}
+	}
+	c.restoreSession(row)
+	return nil
+}
+
+// moveLinks changes the owner of links, calls persist for changed rows
+// and only then makes the change visible.
+func (c *MemoryStorage) moveLinks(fromUserID, toUserID string, persist func([]Row) error) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows := make([]Row, 0)
+	for _, row := range c.links {
+		if row.UserID == fromUserID {
+			row.UserID = toUserID
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if persist != nil {
+		if err := persist(rows); err != nil {
+			return 0, err
+		}
+	}
+	for i := range rows {
+		c.restore(rows[i])
+	}
+	return int64(len(rows)), nil
+}
+
+// restoreSession puts an already persisted session into the index. Caller must hold the lock.
+func (c *MemoryStorage) restoreSession(row SessionRow) {
+	if row.IsDeleted {
+		delete(c.sessions, row.ID)
+		return
+	}
+	c.sessions[row.ID] = row
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+type APIKeyRow struct {
+	ID        string    `db:"id" json:"id"`
+	UserID    string    `db:"user_id" json:"user_id"`
+	Name      string    `db:"name" json:"name"`
+	Hash      string    `db:"key_hash" json:"key_hash"`
+	Scopes    string    `db:"scopes" json:"scopes"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	// IsDeleted marks a revoked key in the file storage log
+	IsDeleted bool `db:"-" json:"is_deleted,omitempty"`
+}
+
+func (r APIKeyRow) apiKey() services.APIKey {
+	return services.APIKey{
+		ID:        r.ID,
+		UserID:    r.UserID,
+		Name:      r.Name,
+		Hash:      r.Hash,
+		Scopes:    strings.Split(r.Scopes, ","),
+		CreatedAt: r.CreatedAt,
+	}
+}
+
+func newAPIKeyRow(key services.APIKey) APIKeyRow {
+	return APIKeyRow{
+		ID:        key.ID,
+		UserID:    key.UserID,
+		Name:      key.Name,
+		Hash:      key.Hash,
+		Scopes:    strings.Join(key.Scopes, ","),
+		CreatedAt: key.CreatedAt.UTC(),
+	}
+}
+
+func (c *Storage) AddAPIKey(ctx context.Context, key services.APIKey) error {
+	_, err := c.db.NamedExecContext(ctx,
+		"INSERT INTO api_key(id, user_id, name, key_hash, scopes, created_at) VALUES(:id, :user_id, :name, :key_hash, :scopes, :created_at)",
+		newAPIKeyRow(key),
+	)
+	return err
+}
+
+func (c *Storage) GetAPIKey(ctx context.Context, hash string) (services.APIKey, error) {
+	var row APIKeyRow
+	err := c.db.GetContext(ctx, &row, "SELECT * FROM api_key WHERE key_hash=$1", hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.APIKey{}, services.ErrAPIKeyNotFound
+	} else if err != nil {
+		return services.APIKey{}, err
+	}
+	return row.apiKey(), nil
+}
+
+func (c *Storage) GetUserAPIKeys(ctx context.Context, userID string) ([]services.APIKey, error) {
+	rows := make([]APIKeyRow, 0)
+	err := c.db.SelectContext(ctx, &rows, "SELECT * FROM api_key WHERE user_id=$1 ORDER BY created_at, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]services.APIKey, len(rows))
+	for i := range rows {
+		keys[i] = rows[i].apiKey()
+	}
+	return keys, nil
+}
+
+func (c *Storage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	result, err := c.db.ExecContext(ctx, "DELETE FROM api_key WHERE user_id=$1 AND id=$2", userID, id)
+	if err != nil {
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return services.ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (c *MemoryStorage) AddAPIKey(ctx context.Context, key services.APIKey) error {
+	return c.putAPIKey(newAPIKeyRow(key), nil)
+}
+
+func (c *MemoryStorage) GetAPIKey(ctx context.Context, hash string) (services.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	row, ok := c.apiKeys[hash]
+	if !ok {
+		return services.APIKey{}, services.ErrAPIKeyNotFound
+	}
+	return row.apiKey(), nil
+}
+
+func (c *MemoryStorage) GetUserAPIKeys(ctx context.Context, userID string) ([]services.APIKey, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rows := make([]APIKeyRow, 0)
+	for _, row := range c.apiKeys {
+		if row.UserID == userID {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Equal(rows[j].CreatedAt) {
+			return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+		}
+		return rows[i].ID < rows[j].ID
+	})
+
+	keys := make([]services.APIKey, len(rows))
+	for i := range rows {
+		keys[i] = rows[i].apiKey()
+	}
+	return keys, nil
+}
+
+func (c *MemoryStorage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	return c.deleteAPIKey(userID, id, nil)
+}
+
+// putAPIKey calls persist for a new key and only then makes it visible.
+func (c *MemoryStorage) putAPIKey(row APIKeyRow, persist func(APIKeyRow) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if persist != nil {
+		if err := persist(row); err != nil {
+			return err
+		}
+	}
+	c.restoreAPIKey(row)
+	return nil
+}
+
+// deleteAPIKey persists a deleted copy of the user's key and only then removes it.
+func (c *MemoryStorage) deleteAPIKey(userID, id string, persist func(APIKeyRow) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, row := range c.apiKeys {
+		if row.UserID != userID || row.ID != id {
+			continue
+		}
+		row.IsDeleted = true
+		if persist != nil {
+			if err := persist(row); err != nil {
+				return err
+			}
+		}
+		c.restoreAPIKey(row)
+		return nil
+	}
+	return services.ErrAPIKeyNotFound
+}
+
+// restoreAPIKey puts an already persisted key into the index. Caller must hold the lock.
+func (c *MemoryStorage) restoreAPIKey(row APIKeyRow) {
+	if row.IsDeleted {
+		delete(c.apiKeys, row.Hash)
+		return
+	}
+	c.apiKeys[row.Hash] = row
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+type ClickRow struct {
+	Key       string `db:"short_key" json:"key"`
+	ClickedAt int64  `db:"clicked_at" json:"clicked_at"`
+	Referrer  string `db:"referrer" json:"referrer,omitempty"`
+	UserAgent string `db:"user_agent" json:"user_agent,omitempty"`
+	VisitorIP string `db:"visitor_ip" json:"visitor_ip,omitempty"`
+}
+
+func newClickRows(clicks []services.Click) []ClickRow {
+	rows := make([]ClickRow, len(clicks))
+	for i, click := range clicks {
+		rows[i] = ClickRow{
+			Key:       click.Key,
+			ClickedAt: click.At.Unix(),
+			Referrer:  click.Referrer,
+			UserAgent: click.UserAgent,
+			VisitorIP: click.IP,
+		}
+	}
+	return rows
+}
+
+func (r ClickRow) click() services.Click {
+	return services.Click{
+		Key:       r.Key,
+		At:        time.Unix(r.ClickedAt, 0).UTC(),
+		Referrer:  r.Referrer,
+		UserAgent: r.UserAgent,
+		IP:        r.VisitorIP,
+	}
+}
+
+func (c *Storage) AddClicks(ctx context.Context, clicks []services.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	rows := newClickRows(clicks)
+	query := `INSERT INTO click(short_key, clicked_at, referrer, user_agent, visitor_ip)
+		VALUES(:short_key, :clicked_at, :referrer, :user_agent, :visitor_ip)`
+	_, err := c.db.NamedExecContext(ctx, query, rows)
+	return err
+}
+
+func (c *Storage) GetStats(ctx context.Context, key string, since time.Time, bucket time.Duration) (services.LinkStats, error) {
+	stats := services.LinkStats{Key: key, Buckets: make([]services.StatsBucket, 0)}
+	var totals struct {
+		Total          int64 `db:"total"`
+		UniqueVisitors int64 `db:"unique_visitors"`
+	}
+	err := c.db.GetContext(ctx, &totals,
+		`SELECT COUNT(*) AS total, COUNT(DISTINCT visitor_ip || '|' || user_agent) AS unique_visitors
+		FROM click WHERE short_key=$1 AND clicked_at >= $2`,
+		key, since.Unix(),
+	)
+	if err != nil {
+		return stats, err
+	}
+	stats.Total = totals.Total
+	stats.UniqueVisitors = totals.UniqueVisitors
+
+	rows := make([]struct {
+		Start  int64 `db:"bucket"`
+		Clicks int64 `db:"clicks"`
+	}, 0)
+	err = c.db.SelectContext(ctx, &rows,
+		`SELECT (clicked_at / $1) * $1 AS bucket, COUNT(*) AS clicks
+		FROM click WHERE short_key=$2 AND clicked_at >= $3
+		GROUP BY bucket ORDER BY bucket`,
+		bucketSeconds(bucket), key, since.Unix(),
+	)
+	if err != nil {
+		return stats, err
+	}
+	for _, row := range rows {
+		stats.Buckets = append(stats.Buckets, services.StatsBucket{
+			Start:  time.Unix(row.Start, 0).UTC(),
+			Clicks: row.Clicks,
+		})
+	}
+	return stats, nil
+}
+
+// aggregateClicks counts stats the same way as the database query does.
+func aggregateClicks(key string, clicks []services.Click, since time.Time, bucket time.Duration) services.LinkStats {
+	stats := services.LinkStats{Key: key, Buckets: make([]services.StatsBucket, 0)}
+	size := bucketSeconds(bucket)
+	visitors := make(map[string]struct{})
+	for _, click := range clicks {
+		at := click.At.Unix()
+		if at < since.Unix() {
+			continue
+		}
+		stats.Total++
+		visitors[click.IP+"|"+click.UserAgent] = struct{}{}
+
+		start := time.Unix(at/size*size, 0).UTC()
+		last := len(stats.Buckets) - 1
+		if last >= 0 && stats.Buckets[last].Start.Equal(start) {
+			stats.Buckets[last].Clicks++
+			continue
+		}
+		stats.Buckets = append(stats.Buckets, services.StatsBucket{Start: start, Clicks: 1})
+	}
+	stats.UniqueVisitors = int64(len(visitors))
+	return stats
+}
+
+func bucketSeconds(bucket time.Duration) int64 {
+	size := int64(bucket / time.Second)
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
@@ -0,0 +1,13 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+var (
+	ErrNotFound  = services.ErrLinkNotFound
+	ErrURLExists = services.ErrURLExists
+	ErrClosed    = errors.New("storage is closed")
+)
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// FileStorage keeps links in memory and appends every new link to a file.
+// The file is replayed on start, so links survive restarts.
+// Accounts, sessions, API keys and clicks are stored in the same file as records.
+type FileStorage struct {
+	*MemoryStorage
+	fileMu sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// record is a line of the file, links are written as plain rows
+// to keep files of older versions readable.
+type record struct {
+	Row
+	Account *AccountRow `json:"account,omitempty"`
+	Session *SessionRow `json:"session,omitempty"`
+	APIKey  *APIKeyRow  `json:"api_key,omitempty"`
+	Click   *ClickRow   `json:"click,omitempty"`
+}
+
+func (r record) MarshalJSON() ([]byte, error) {
+	switch {
+	case r.Account != nil:
+		return json.Marshal(struct {
+			Account *AccountRow `json:"account"`
+		}{r.Account})
+	case r.Session != nil:
+		return json.Marshal(struct {
+			Session *SessionRow `json:"session"`
+		}{r.Session})
+	case r.APIKey != nil:
+		return json.Marshal(struct {
+			APIKey *APIKeyRow `json:"api_key"`
+		}{r.APIKey})
+	case r.Click != nil:
+		return json.Marshal(struct {
+			Click *ClickRow `json:"click"`
+		}{r.Click})
+	}
+	return json.Marshal(r.Row)
+}
+
+func NewFileStorage(path string) (*FileStorage, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStorage{
+		MemoryStorage: NewMemoryStorage(),
+		file:          file,
+		writer:        bufio.NewWriter(file),
+	}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *FileStorage) Ping(ctx context.Context) error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	if c.file == nil {
+		return ErrClosed
+	}
+	_, err := c.file.Stat()
+	return err
+}
+
+func (c *FileStorage) Add(ctx context.Context, link services.Link, keyFunc services.KeyFunc) (string, error) {
+	ids, err := c.insert([]services.Link{link}, keyFunc, c.write)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+func (c *FileStorage) AddByBatch(ctx context.Context, links []services.Link, keyFunc services.KeyFunc) ([]string, error) {
+	if len(links) == 0 {
+		return make([]string, 0), nil
+	}
+	return c.insert(links, keyFunc, c.write)
+}
+
+// Delete appends deleted copies of rows, so the last record of a link wins on replay.
+func (c *FileStorage) Delete(ctx context.Context, tasks []services.DeleteTask) error {
+	return c.delete(tasks, c.write)
+}
+
+// SweepExpired appends purged or deleted copies of expired rows.
+func (c *FileStorage) SweepExpired(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	return c.sweep(before, archive, c.write)
+}
+
+func (c *FileStorage) AddAccount(ctx context.Context, account services.Account) error {
+	return c.addAccount(newAccountRow(account), func(row AccountRow) error {
+		return c.writeRecords(record{Account: &row})
+	})
+}
+
+func (c *FileStorage) AddSession(ctx context.Context, session services.Session) error {
+	return c.putSession(newSessionRow(session), c.writeSession)
+}
+
+// DeleteSession appends a deleted copy of the session, it is skipped on replay.
+func (c *FileStorage) DeleteSession(ctx context.Context, id string) error {
+	return c.putSession(SessionRow{ID: id, IsDeleted: true}, c.writeSession)
+}
+
+func (c *FileStorage) MoveUserLinks(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	return c.moveLinks(fromUserID, toUserID, c.write)
+}
+
+func (c *FileStorage) AddAPIKey(ctx context.Context, key services.APIKey) error {
+	return c.putAPIKey(newAPIKeyRow(key), c.writeAPIKey)
+}
+
+// DeleteAPIKey appends a deleted copy of the key, it is skipped on replay.
+func (c *FileStorage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	return c.deleteAPIKey(userID, id, c.writeAPIKey)
+}
+
+func (c *FileStorage) AddClicks(ctx context.Context, clicks []services.Click) error {
+	return c.addClicks(clicks, c.writeClicks)
+}
+
+func (c *FileStorage) Close() error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+func (c *FileStorage) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	scanner := bufio.NewScanner(c.file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return err
+		}
+		switch {
+		case rec.Account != nil:
+			c.accounts[rec.Account.Login] = *rec.Account
+		case rec.Session != nil:
+			c.restoreSession(*rec.Session)
+		case rec.APIKey != nil:
+			c.restoreAPIKey(*rec.APIKey)
+		case rec.Click != nil:
+			c.clicks[rec.Click.Key] = append(c.clicks[rec.Click.Key], rec.Click.click())
+		default:
+			c.restore(rec.Row)
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *FileStorage) write(rows []Row) error {
+	records := make([]record, len(rows))
+	for i := range rows {
+		records[i] = record{Row: rows[i]}
+	}
+	return c.writeRecords(records...)
+}
+
+func (c *FileStorage) writeSession(row SessionRow) error {
+	return c.writeRecords(record{Session: &row})
+}
+
+func (c *FileStorage) writeAPIKey(row APIKeyRow) error {
+	return c.writeRecords(record{APIKey: &row})
+}
+
+func (c *FileStorage) writeClicks(rows []ClickRow) error {
+	records := make([]record, len(rows))
+	for i := range rows {
+		records[i] = record{Click: &rows[i]}
+	}
+	return c.writeRecords(records...)
+}
+
+func (c *FileStorage) writeRecords(records ...record) error {
+	c.fileMu.Lock()
+	defer c.fileMu.Unlock()
+	if c.file == nil {
+		return ErrClosed
+	}
+	encoder := json.NewEncoder(c.writer)
+	for i := range records {
+		if err := encoder.Encode(records[i]); err != nil {
+			c.writer.Reset(c.file)
+			return err
+		}
+	}
+	if err := c.writer.Flush(); err != nil {
+		c.writer.Reset(c.file)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+func TestFileStorage(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "storage.txt")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(err)
+
+	key, err := s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user1"}, nil)
+	assert.Nil(err)
+	assert.Equal("1", key)
+
+	_, err = s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user2"}, nil)
+	var existErr *services.LinkExistError
+	assert.True(errors.As(err, &existErr))
+	assert.Equal("1", existErr.Key)
+
+	keys, err := s.AddByBatch(ctx, newLinks("user2", "http://example.com/2", "http://example.com/3"), nil)
+	assert.Nil(err)
+	assert.Equal([]string{"2", "3"}, keys)
+
+	_, err = s.AddByBatch(ctx, newLinks("user2", "http://example.com/4", "http://example.com/2"), nil)
+	assert.True(errors.As(err, &existErr))
+	assert.Equal("2", existErr.Key)
+
+	_, err = s.Get(ctx, "4")
+	assert.ErrorIs(err, ErrNotFound)
+	assert.Nil(s.Delete(ctx, []services.DeleteTask{{UserID: "user1", Keys: []string{"1"}}}))
+	assert.Nil(s.Close())
+
+	// replay file on start
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+
+	_, err = s.Get(ctx, "1")
+	assert.ErrorIs(err, services.ErrLinkDeleted)
+
+	link, err := s.Get(ctx, "3")
+	assert.Nil(err)
+	assert.Equal("http://example.com/3", link.URL)
+
+	links, err := s.GetAllUserURLs(ctx, "user2")
+	assert.Nil(err)
+	assert.Equal([]services.Link{
+		{Key: "2", URL: "http://example.com/2", UserID: "user2"},
+		{Key: "3", URL: "http://example.com/3", UserID: "user2"},
+	}, links)
+
+	key, err = s.Add(ctx, services.Link{URL: "http://example.com/4", UserID: "user1"}, nil)
+	assert.Nil(err)
+	assert.Equal("4", key)
+
+	// purged links are gone after replay
+	expiresAt := time.Now().Add(-time.Second)
+	key, err = s.Add(ctx, services.Link{URL: "http://example.com/5", UserID: "user1", ExpiresAt: &expiresAt}, nil)
+	assert.Nil(err)
+	count, err := s.SweepExpired(ctx, time.Now(), false)
+	assert.Nil(err)
+	assert.Equal(int64(1), count)
+	assert.Nil(s.Close())
+
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+	_, err = s.Get(ctx, key)
+	assert.ErrorIs(err, ErrNotFound)
+
+	// urls of deleted and expired links can be shortened again
+	key, err = s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user1"}, nil)
+	assert.Nil(err)
+	assert.NotEqual("1", key)
+	expired, err := s.Add(ctx, services.Link{URL: "http://example.com/6", UserID: "user1", ExpiresAt: &expiresAt}, nil)
+	assert.Nil(err)
+	renewed, err := s.Add(ctx, services.Link{URL: "http://example.com/6", UserID: "user1"}, nil)
+	assert.Nil(err)
+	assert.Nil(s.Close())
+
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+	defer s.Close()
+	_, err = s.Get(ctx, expired)
+	assert.ErrorIs(err, services.ErrLinkDeleted)
+	_, err = s.Add(ctx, services.Link{URL: "http://example.com/6", UserID: "user1"}, nil)
+	assert.True(errors.As(err, &existErr))
+	assert.Equal(renewed, existErr.Key)
+	_, err = s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user1"}, nil)
+	assert.True(errors.As(err, &existErr))
+	assert.Equal(key, existErr.Key)
+}
+
+func TestFileStorage_Clicks(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "storage.txt")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(err)
+
+	at := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.Nil(s.AddClicks(ctx, []services.Click{
+		{Key: "1", At: at, IP: "192.168.10.0"},
+		{Key: "1", At: at.Add(time.Hour), IP: "192.168.11.0"},
+		{Key: "2", At: at, IP: "192.168.10.0"},
+	}))
+	assert.Nil(s.Close())
+
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+	defer s.Close()
+
+	stats, err := s.GetStats(ctx, "1", at.Add(-time.Hour), 24*time.Hour)
+	assert.Nil(err)
+	assert.Equal(int64(2), stats.Total)
+	assert.Equal(int64(2), stats.UniqueVisitors)
+}
+
+func TestFileStorage_Accounts(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "storage.txt")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(err)
+
+	account := services.Account{ID: "account", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now().UTC()}
+	assert.Nil(s.AddAccount(ctx, account))
+	assert.ErrorIs(s.AddAccount(ctx, account), services.ErrLoginExists)
+
+	session := services.Session{ID: "session", UserID: "account", ExpiresAt: time.Now().Add(time.Hour).UTC()}
+	assert.Nil(s.AddSession(ctx, session))
+	assert.Nil(s.AddSession(ctx, services.Session{ID: "old", UserID: "account", ExpiresAt: session.ExpiresAt}))
+	assert.Nil(s.DeleteSession(ctx, "old"))
+
+	_, err = s.AddByBatch(ctx, newLinks("anonymous", "http://example.com/1", "http://example.com/2"), nil)
+	assert.Nil(err)
+	count, err := s.MoveUserLinks(ctx, "anonymous", "account")
+	assert.Nil(err)
+	assert.Equal(int64(2), count)
+	assert.Nil(s.Close())
+
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+	defer s.Close()
+
+	stored, err := s.GetAccount(ctx, "alice")
+	assert.Nil(err)
+	assert.Equal(account.PasswordHash, stored.PasswordHash)
+	_, err = s.GetAccount(ctx, "bob")
+	assert.ErrorIs(err, services.ErrAccountNotFound)
+
+	_, err = s.GetSession(ctx, "session")
+	assert.Nil(err)
+	_, err = s.GetSession(ctx, "old")
+	assert.ErrorIs(err, services.ErrSessionNotFound)
+
+	links, err := s.GetAllUserURLs(ctx, "account")
+	assert.Nil(err)
+	assert.Len(links, 2)
+}
+
+func TestFileStorage_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "storage.txt")
+
+	s, err := NewFileStorage(path)
+	assert.Nil(err)
+
+	key := services.APIKey{ID: "1", UserID: "user", Hash: "hash1", Scopes: []string{services.ScopeLinksCreate, services.ScopeStatsRead}}
+	assert.Nil(s.AddAPIKey(ctx, key))
+	assert.Nil(s.AddAPIKey(ctx, services.APIKey{ID: "2", UserID: "user", Hash: "hash2", Scopes: []string{services.ScopeLinksRead}}))
+	assert.ErrorIs(s.DeleteAPIKey(ctx, "other", "2"), services.ErrAPIKeyNotFound)
+	assert.Nil(s.DeleteAPIKey(ctx, "user", "2"))
+	assert.Nil(s.Close())
+
+	s, err = NewFileStorage(path)
+	assert.Nil(err)
+	defer s.Close()
+
+	stored, err := s.GetAPIKey(ctx, "hash1")
+	assert.Nil(err)
+	assert.Equal(key.Scopes, stored.Scopes)
+	_, err = s.GetAPIKey(ctx, "hash2")
+	assert.ErrorIs(err, services.ErrAPIKeyNotFound)
+
+	keys, err := s.GetUserAPIKeys(ctx, "user")
+	assert.Nil(err)
+	assert.Len(keys, 1)
+}
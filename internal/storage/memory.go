@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// MemoryStorage keeps links in process memory only. It is safe for concurrent use.
+type MemoryStorage struct {
+	mu     sync.RWMutex
+	lastID int
+	links  map[string]Row
+	urls   map[string]string
+	clicks map[string][]services.Click
+	// accounts are indexed by login
+	accounts map[string]AccountRow
+	sessions map[string]SessionRow
+	// apiKeys are indexed by hash
+	apiKeys map[string]APIKeyRow
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		links:    make(map[string]Row),
+		urls:     make(map[string]string),
+		clicks:   make(map[string][]services.Click),
+		accounts: make(map[string]AccountRow),
+		sessions: make(map[string]SessionRow),
+		apiKeys:  make(map[string]APIKeyRow),
+	}
+}
+
+func (c *MemoryStorage) Close() error {
+	return nil
+}
+
+func (c *MemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (c *MemoryStorage) Add(ctx context.Context, link services.Link, keyFunc services.KeyFunc) (string, error) {
+	ids, err := c.insert([]services.Link{link}, keyFunc, nil)
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+func (c *MemoryStorage) Get(ctx context.Context, key string) (services.Link, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	row, ok := c.links[key]
+	if !ok {
+		return services.Link{}, ErrNotFound
+	}
+	if row.IsDeleted {
+		return services.Link{}, services.ErrLinkDeleted
+	}
+	return row.link(), nil
+}
+
+func (c *MemoryStorage) GetAllUserURLs(ctx context.Context, userID string) ([]services.Link, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rows := make([]Row, 0)
+	for _, row := range c.links {
+		if row.UserID == userID && !row.IsDeleted {
+			rows = append(rows, row)
+		}
+	}
+	sortRows(rows)
+
+	data := make([]services.Link, len(rows))
+	for i := range rows {
+		data[i] = rows[i].link()
+	}
+	return data, nil
+}
+
+func (c *MemoryStorage) AddByBatch(ctx context.Context, links []services.Link, keyFunc services.KeyFunc) ([]string, error) {
+	if len(links) == 0 {
+		return make([]string, 0), nil
+	}
+	return c.insert(links, keyFunc, nil)
+}
+
+func (c *MemoryStorage) Delete(ctx context.Context, tasks []services.DeleteTask) error {
+	return c.delete(tasks, nil)
+}
+
+func (c *MemoryStorage) SweepExpired(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	return c.sweep(before, archive, nil)
+}
+
+func (c *MemoryStorage) AddClicks(ctx context.Context, clicks []services.Click) error {
+	return c.addClicks(clicks, nil)
+}
+
+// addClicks calls persist for new rows before the clicks are counted.
+func (c *MemoryStorage) addClicks(clicks []services.Click, persist func([]ClickRow) error) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if persist != nil {
+		if err := persist(newClickRows(clicks)); err != nil {
+			return err
+		}
+	}
+	for _, click := range clicks {
+		c.clicks[click.Key] = append(c.clicks[click.Key], click)
+	}
+	return nil
+}
+
+func (c *MemoryStorage) GetStats(ctx context.Context, key string, since time.Time, bucket time.Duration) (services.LinkStats, error) {
+	c.mu.RLock()
+	clicks := make([]services.Click, len(c.clicks[key]))
+	copy(clicks, c.clicks[key])
+	c.mu.RUnlock()
+
+	sort.Slice(clicks, func(i, j int) bool { return clicks[i].At.Before(clicks[j].At) })
+	return aggregateClicks(key, clicks, since, bucket), nil
+}
+
+// insert checks links for conflicts, calls persist for new rows and only then
+// makes them visible. The whole batch is rejected on any conflict.
+func (c *MemoryStorage) insert(links []services.Link, keyFunc services.KeyFunc, persist func([]Row) error) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	nextID := int64(c.lastID)
+	rows := make([]Row, len(links))
+	archived := make([]Row, 0)
+	urls := make(map[string]struct{}, len(links))
+	keys := make(map[string]struct{}, len(links))
+	taken := func(key string) bool {
+		_, inStorage := c.links[key]
+		_, inBatch := keys[key]
+		return inStorage || inBatch
+	}
+	for i, link := range links {
+		if key, ok := c.urls[link.URL]; ok {
+			row := c.links[key]
+			if !row.link().IsExpired(now) {
+				return nil, services.NewLinkExistError(key, ErrURLExists)
+			}
+			// an expired link not swept yet frees its url for the new one
+			row.IsDeleted = true
+			archived = append(archived, row)
+		}
+		if _, ok := urls[link.URL]; ok {
+			return nil, ErrURLExists
+		}
+		urls[link.URL] = struct{}{}
+
+		nextID++
+		key := link.Key
+		if key == "" {
+			// a generated key taken by an alias burns the id, the link gets the next one
+			for attempt := 1; ; attempt++ {
+				var err error
+				if key, err = generateKey(keyFunc, nextID); err != nil {
+					return nil, err
+				}
+				if !taken(key) || attempt == keyIDAttempts {
+					break
+				}
+				nextID++
+			}
+		}
+		if taken(key) {
+			return nil, services.ErrKeyExists
+		}
+		keys[key] = struct{}{}
+		id := nextID
+
+		rows[i] = Row{
+			ID:             strconv.FormatInt(id, 10),
+			Key:            key,
+			UserID:         link.UserID,
+			OriginURL:      link.URL,
+			ExpiresAt:      utc(link.ExpiresAt),
+			RedirectStatus: link.RedirectStatus,
+			MergeQuery:     link.MergeQuery,
+			ForwardPath:    link.ForwardPath,
+		}
+	}
+	if persist != nil {
+		if err := persist(append(archived, rows...)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range archived {
+		c.restore(archived[i])
+	}
+	ids := make([]string, len(rows))
+	for i := range rows {
+		c.restore(rows[i])
+		ids[i] = rows[i].Key
+	}
+	return ids, nil
+}
+
+// delete marks links of task owners as deleted, calls persist
+// for changed rows and only then makes the change visible.
+func (c *MemoryStorage) delete(tasks []services.DeleteTask, persist func([]Row) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows := make([]Row, 0)
+	for _, task := range tasks {
+		for _, key := range task.Keys {
+			row, ok := c.links[key]
+			if !ok || row.IsDeleted || row.UserID != task.UserID {
+				continue
+			}
+			row.IsDeleted = true
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if persist != nil {
+		if err := persist(rows); err != nil {
+			return err
+		}
+	}
+	for i := range rows {
+		c.restore(rows[i])
+	}
+	return nil
+}
+
+// sweep removes or marks deleted links expired before the moment,
+// calls persist for changed rows and only then makes the change visible.
+func (c *MemoryStorage) sweep(before time.Time, archive bool, persist func([]Row) error) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rows := make([]Row, 0)
+	for _, row := range c.links {
+		if !row.link().IsExpired(before) || (archive && row.IsDeleted) {
+			continue
+		}
+		if archive {
+			row.IsDeleted = true
+		} else {
+			row.IsPurged = true
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if persist != nil {
+		if err := persist(rows); err != nil {
+			return 0, err
+		}
+	}
+	for i := range rows {
+		c.restore(rows[i])
+	}
+	return int64(len(rows)), nil
+}
+
+// restore puts an already persisted row into the index or removes
+// a purged one. Caller must hold the lock.
+func (c *MemoryStorage) restore(row Row) {
+	if id, err := strconv.Atoi(row.ID); err == nil && id > c.lastID {
+		c.lastID = id
+	}
+	if row.Key == "" {
+		row.Key = row.ID
+	}
+	if c.urls[row.OriginURL] == row.Key && (row.IsPurged || row.IsDeleted) {
+		delete(c.urls, row.OriginURL)
+	}
+	if row.IsPurged {
+		delete(c.links, row.Key)
+		return
+	}
+	c.links[row.Key] = row
+	if !row.IsDeleted {
+		c.urls[row.OriginURL] = row.Key
+	}
+}
+
+func sortRows(rows []Row) {
+	sort.Slice(rows, func(i, j int) bool {
+		a, _ := strconv.Atoi(rows[i].ID)
+		b, _ := strconv.Atoi(rows[j].ID)
+		return a < b
+	})
+}
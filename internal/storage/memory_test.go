@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+func TestMemoryStorage_Add(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Add(ctx, services.Link{URL: fmt.Sprintf("http://example.com/%d", i%10), UserID: "user"}, nil)
+			var existErr *services.LinkExistError
+			if err != nil {
+				assert.True(t, errors.As(err, &existErr))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	urls, err := s.GetAllUserURLs(ctx, "user")
+	assert.Nil(t, err)
+	assert.Len(t, urls, 10)
+}
+
+func TestMemoryStorage_AddByBatch(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	_, err := s.AddByBatch(ctx, newLinks("user", "http://example.com", "http://example.com"), nil)
+	assert.ErrorIs(t, err, ErrURLExists)
+	assert.ErrorIs(t, err, services.ErrConflict)
+
+	keys, err := s.AddByBatch(ctx, newLinks("user", "http://example.com", "http://example.com/2"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1", "2"}, keys)
+
+	_, err = s.AddByBatch(ctx, newLinks("user", "http://example.com/3", "http://example.com/2"), nil)
+	var existErr *services.LinkExistError
+	assert.True(t, errors.As(err, &existErr))
+	assert.Equal(t, "2", existErr.Key)
+
+	_, err = s.Get(ctx, "3")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = s.AddByBatch(ctx, []services.Link{
+		{Key: "sale", URL: "http://example.com/3", UserID: "user"},
+		{Key: "sale", URL: "http://example.com/4", UserID: "user"},
+	}, nil)
+	assert.ErrorIs(t, err, services.ErrKeyExists)
+}
+
+func TestMemoryStorage_AddAliasOfGeneratedKey(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStorage()
+
+	// the alias takes the key of the next id, which is burned
+	_, err := s.Add(ctx, services.Link{Key: "2", URL: "http://example.com/alias", UserID: "user"}, nil)
+	assert.Nil(t, err)
+	keys, err := s.AddByBatch(ctx, newLinks("user", "http://example.com/1", "http://example.com/2"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "4"}, keys)
+	key, err := s.Add(ctx, services.Link{URL: "http://example.com/3", UserID: "user"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "5", key)
+}
@@ -1,36 +1,416 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
-const schemaSqlite3 = `
+const (
+	driverSqlite3  = "sqlite3"
+	driverPostgres = "pgx"
+)
+
+var ErrUnsupportedDriver = errors.New("unsupported driver type")
+
+// migration describes one schema change. Up and Down hold a statement per driver.
+type migration struct {
+	Version int
+	Name    string
+	Up      map[string]string
+	Down    map[string]string
+}
+
+// MigrationState is a migration with the time it was applied, nil for pending ones.
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// migrations must be ordered by version and never changed after release,
+// add a new one instead.
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create link",
+		Up: map[string]string{
+			driverSqlite3: `
 CREATE TABLE IF NOT EXISTS link (
     id INTEGER PRIMARY KEY,
     user_id VARCHAR(32) NOT NULL,
-    origin_url text NOT NULL
-)`
-const schemaPostgres = `
+    origin_url text NOT NULL UNIQUE
+)`,
+			driverPostgres: `
 CREATE TABLE IF NOT EXISTS link (
     id SERIAL,
     user_id VARCHAR(32) NOT NULL,
     origin_url text NOT NULL UNIQUE,
 	constraint cnst_link_origin_url unique (origin_url)
+)`,
+		},
+		Down: map[string]string{
+			driverSqlite3:  `DROP TABLE IF EXISTS link`,
+			driverPostgres: `DROP TABLE IF EXISTS link`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add link is_deleted",
+		Up: map[string]string{
+			driverSqlite3:  `ALTER TABLE link ADD COLUMN is_deleted BOOLEAN NOT NULL DEFAULT FALSE`,
+			driverPostgres: `ALTER TABLE link ADD COLUMN is_deleted BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+		Down: map[string]string{
+			driverSqlite3:  `ALTER TABLE link DROP COLUMN is_deleted`,
+			driverPostgres: `ALTER TABLE link DROP COLUMN is_deleted`,
+		},
+	},
+	{
+		Version: 3,
+		Name:    "add link short_key",
+		Up: map[string]string{
+			driverSqlite3: `
+ALTER TABLE link ADD COLUMN short_key VARCHAR(64);
+UPDATE link SET short_key = CAST(id AS TEXT);
+CREATE UNIQUE INDEX link_short_key_idx ON link (short_key)`,
+			driverPostgres: `
+ALTER TABLE link ADD COLUMN short_key VARCHAR(64);
+UPDATE link SET short_key = CAST(id AS TEXT);
+CREATE UNIQUE INDEX link_short_key_idx ON link (short_key)`,
+		},
+		Down: map[string]string{
+			driverSqlite3: `
+DROP INDEX link_short_key_idx;
+ALTER TABLE link DROP COLUMN short_key`,
+			driverPostgres: `ALTER TABLE link DROP COLUMN short_key`,
+		},
+	},
+	{
+		// a url is unique among active links only, so it can be shortened again
+		// after its link expires or is deleted; sqlite can't drop a column
+		// constraint, so the table is rebuilt
+		Version: 4,
+		Name:    "add link expires_at",
+		Up: map[string]string{
+			driverSqlite3: `
+CREATE TABLE link_new (
+    id INTEGER PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL,
+    origin_url text NOT NULL,
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    short_key VARCHAR(64),
+    expires_at TIMESTAMP NULL
+);
+INSERT INTO link_new (id, user_id, origin_url, is_deleted, short_key)
+SELECT id, user_id, origin_url, is_deleted, short_key FROM link;
+DROP TABLE link;
+ALTER TABLE link_new RENAME TO link;
+CREATE UNIQUE INDEX link_short_key_idx ON link (short_key);
+CREATE INDEX link_expires_at_idx ON link (expires_at);
+CREATE UNIQUE INDEX link_active_origin_url_idx ON link (origin_url) WHERE NOT is_deleted`,
+			driverPostgres: `
+ALTER TABLE link ADD COLUMN expires_at TIMESTAMPTZ NULL;
+CREATE INDEX link_expires_at_idx ON link (expires_at);
+ALTER TABLE link DROP CONSTRAINT IF EXISTS link_origin_url_key;
+ALTER TABLE link DROP CONSTRAINT IF EXISTS cnst_link_origin_url;
+CREATE UNIQUE INDEX link_active_origin_url_idx ON link (origin_url) WHERE NOT is_deleted`,
+		},
+		Down: map[string]string{
+			driverSqlite3: `
+CREATE TABLE link_old (
+    id INTEGER PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL,
+    origin_url text NOT NULL UNIQUE,
+    is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    short_key VARCHAR(64)
+);
+INSERT INTO link_old (id, user_id, origin_url, is_deleted, short_key)
+SELECT id, user_id, origin_url, is_deleted, short_key FROM link;
+DROP TABLE link;
+ALTER TABLE link_old RENAME TO link;
+CREATE UNIQUE INDEX link_short_key_idx ON link (short_key)`,
+			driverPostgres: `
+DROP INDEX link_active_origin_url_idx;
+ALTER TABLE link ADD CONSTRAINT cnst_link_origin_url UNIQUE (origin_url);
+ALTER TABLE link DROP COLUMN expires_at`,
+		},
+	},
+	{
+		// clicked_at is unix seconds, so buckets are computed the same way by all drivers
+		Version: 5,
+		Name:    "create click",
+		Up: map[string]string{
+			driverSqlite3: `
+CREATE TABLE click (
+    id INTEGER PRIMARY KEY,
+    short_key VARCHAR(64) NOT NULL,
+    clicked_at BIGINT NOT NULL,
+    referrer text NOT NULL,
+    user_agent text NOT NULL,
+    visitor_ip VARCHAR(64) NOT NULL
+);
+CREATE INDEX click_short_key_idx ON click (short_key, clicked_at)`,
+			driverPostgres: `
+CREATE TABLE click (
+    id BIGSERIAL PRIMARY KEY,
+    short_key VARCHAR(64) NOT NULL,
+    clicked_at BIGINT NOT NULL,
+    referrer text NOT NULL,
+    user_agent text NOT NULL,
+    visitor_ip VARCHAR(64) NOT NULL
+);
+CREATE INDEX click_short_key_idx ON click (short_key, clicked_at)`,
+		},
+		Down: map[string]string{
+			driverSqlite3:  `DROP TABLE click`,
+			driverPostgres: `DROP TABLE click`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create account and account_session",
+		Up: map[string]string{
+			driverSqlite3: `
+CREATE TABLE account (
+    id VARCHAR(32) PRIMARY KEY,
+    login VARCHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE account_session (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX link_user_id_idx ON link (user_id)`,
+			driverPostgres: `
+CREATE TABLE account (
+    id VARCHAR(32) PRIMARY KEY,
+    login VARCHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE account_session (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL REFERENCES account (id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX link_user_id_idx ON link (user_id)`,
+		},
+		Down: map[string]string{
+			driverSqlite3: `
+DROP INDEX link_user_id_idx;
+DROP TABLE account_session;
+DROP TABLE account`,
+			driverPostgres: `
+DROP INDEX link_user_id_idx;
+DROP TABLE account_session;
+DROP TABLE account`,
+		},
+	},
+	{
+		// scopes are comma separated
+		Version: 7,
+		Name:    "create api_key",
+		Up: map[string]string{
+			driverSqlite3: `
+CREATE TABLE api_key (
+    id VARCHAR(16) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes text NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE INDEX api_key_user_id_idx ON api_key (user_id)`,
+			driverPostgres: `
+CREATE TABLE api_key (
+    id VARCHAR(16) PRIMARY KEY,
+    user_id VARCHAR(32) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes text NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX api_key_user_id_idx ON api_key (user_id)`,
+		},
+		Down: map[string]string{
+			driverSqlite3:  `DROP TABLE api_key`,
+			driverPostgres: `DROP TABLE api_key`,
+		},
+	},
+	{
+		// links created before keep redirecting with 307
+		Version: 8,
+		Name:    "add link redirect_status",
+		Up: map[string]string{
+			driverSqlite3:  `ALTER TABLE link ADD COLUMN redirect_status SMALLINT NOT NULL DEFAULT 307`,
+			driverPostgres: `ALTER TABLE link ADD COLUMN redirect_status SMALLINT NOT NULL DEFAULT 307`,
+		},
+		Down: map[string]string{
+			driverSqlite3:  `ALTER TABLE link DROP COLUMN redirect_status`,
+			driverPostgres: `ALTER TABLE link DROP COLUMN redirect_status`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add link merge_query and forward_path",
+		Up: map[string]string{
+			driverSqlite3: `ALTER TABLE link ADD COLUMN merge_query BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE link ADD COLUMN forward_path BOOLEAN NOT NULL DEFAULT FALSE`,
+			driverPostgres: `ALTER TABLE link ADD COLUMN merge_query BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN forward_path BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+		Down: map[string]string{
+			driverSqlite3: `ALTER TABLE link DROP COLUMN merge_query;
+ALTER TABLE link DROP COLUMN forward_path`,
+			driverPostgres: `ALTER TABLE link DROP COLUMN merge_query, DROP COLUMN forward_path`,
+		},
+	},
+}
+
+const schemaMigrations = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
 )`
 
+// Migrate applies all pending migrations.
 func Migrate(db *sqlx.DB) error {
-	var schema string
+	_, err := MigrateUp(db)
+	return err
+}
+
+// LatestVersion returns the schema version expected by the code.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// CurrentVersion returns the version of the last applied migration, 0 for an empty database.
+func CurrentVersion(db *sqlx.DB) (int, error) {
+	if err := prepareMigrations(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return version, err
+}
 
+// CheckMigrations fails when the applied schema version is not LatestVersion,
+// unlike CurrentVersion it never creates the migrations table.
+func (c *Storage) CheckMigrations(ctx context.Context) error {
+	var version int
+	if err := c.db.GetContext(ctx, &version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"); err != nil {
+		return err
+	}
+	if version != LatestVersion() {
+		return fmt.Errorf("schema version is %d, expected %d", version, LatestVersion())
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations and returns their versions.
+func MigrateUp(db *sqlx.DB) ([]int, error) {
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]int, 0)
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+		err := apply(db, m.Up[db.DriverName()],
+			"INSERT INTO schema_migrations(version, name, applied_at) VALUES($1, $2, $3)",
+			m.Version, m.Name, time.Now().UTC(),
+		)
+		if err != nil {
+			return applied, fmt.Errorf("migration %d %q: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m.Version)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts up to steps last applied migrations and returns their versions.
+func MigrateDown(db *sqlx.DB, steps int) ([]int, error) {
+	current, err := CurrentVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	reverted := make([]int, 0)
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		m := migrations[i]
+		if m.Version > current {
+			continue
+		}
+		err := apply(db, m.Down[db.DriverName()],
+			"DELETE FROM schema_migrations WHERE version=$1",
+			m.Version,
+		)
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d %q: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m.Version)
+	}
+	return reverted, nil
+}
+
+// MigrationStatus lists all known migrations with their apply time.
+func MigrationStatus(db *sqlx.DB) ([]MigrationState, error) {
+	if err := prepareMigrations(db); err != nil {
+		return nil, err
+	}
+	rows := make([]struct {
+		Version   int       `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}, 0)
+	if err := db.Select(&rows, "SELECT version, applied_at FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	appliedAt := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		appliedAt[row.Version] = row.AppliedAt
+	}
+
+	result := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		result[i] = MigrationState{Version: m.Version, Name: m.Name}
+		if at, ok := appliedAt[m.Version]; ok {
+			result[i].AppliedAt = &at
+		}
+	}
+	return result, nil
+}
+
+func prepareMigrations(db *sqlx.DB) error {
 	switch db.DriverName() {
-	case "sqlite3":
-		schema = schemaSqlite3
-	case "pgx":
-		schema = schemaPostgres
+	case driverSqlite3, driverPostgres:
 	default:
-		return errors.New("unsupported driver type")
+		return ErrUnsupportedDriver
 	}
-	_, err := db.Exec(schema)
+	_, err := db.Exec(schemaMigrations)
 	return err
 }
+
+// apply runs a schema statement and the bookkeeping query in one transaction.
+func apply(db *sqlx.DB, schema string, query string, args ...interface{}) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,19 +2,45 @@ package storage
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
 	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
 	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/pkg/logging"
 )
 
 type Row struct {
-	ID        string `db:"id"`
-	UserID    string `db:"user_id"`
-	OriginURL string `db:"origin_url"`
+	ID        string     `db:"id" json:"id"`
+	Key       string     `db:"short_key" json:"key,omitempty"`
+	UserID    string     `db:"user_id" json:"user_id"`
+	OriginURL string     `db:"origin_url" json:"origin_url"`
+	IsDeleted bool       `db:"is_deleted" json:"is_deleted,omitempty"`
+	ExpiresAt *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	// IsPurged marks a removed link in the file storage log
+	IsPurged       bool `db:"-" json:"is_purged,omitempty"`
+	RedirectStatus int  `db:"redirect_status" json:"redirect_status,omitempty"`
+	MergeQuery     bool `db:"merge_query" json:"merge_query,omitempty"`
+	ForwardPath    bool `db:"forward_path" json:"forward_path,omitempty"`
+}
+
+func (r Row) link() services.Link {
+	return services.Link{
+		Key:            r.Key,
+		URL:            r.OriginURL,
+		UserID:         r.UserID,
+		ExpiresAt:      r.ExpiresAt,
+		RedirectStatus: r.RedirectStatus,
+		MergeQuery:     r.MergeQuery,
+		ForwardPath:    r.ForwardPath,
+	}
 }
 
 type Storage struct {
@@ -25,102 +51,251 @@ func New(db *sqlx.DB) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+func (c *Storage) Close() error {
+	return c.db.Close()
+}
+
 func (c *Storage) Ping(ctx context.Context) error {
 	return c.db.PingContext(ctx)
 }
 
-func (c *Storage) Add(ctx context.Context, url string, userID string) (string, error) {
-	query := "INSERT INTO link(user_id, origin_url) VALUES($1, $2) returning id"
-
-	var id string
-	var pgErr *pgconn.PgError
-	err := c.db.GetContext(ctx, &id, query, userID, url)
-
-	if errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation {
-		id, err = c.GetURLKey(ctx, url)
-		if err != nil {
-			return "", err
-		}
-		return "", services.NewLinkExistError(id, pgErr)
-	} else if err != nil {
+func (c *Storage) Add(ctx context.Context, link services.Link, keyFunc services.KeyFunc) (string, error) {
+	keys, err := c.AddByBatch(ctx, []services.Link{link}, keyFunc)
+	if err != nil {
 		return "", err
 	}
-	return id, nil
+	return keys[0], nil
 }
 
-func (c *Storage) Get(ctx context.Context, key string) (string, error) {
+func (c *Storage) Get(ctx context.Context, key string) (services.Link, error) {
 	var row Row
-	if err := c.db.GetContext(ctx, &row, "SELECT * FROM link where id=$1", key); err != nil {
-		return "", err
+	err := c.db.GetContext(ctx, &row, "SELECT * FROM link where short_key=$1", key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return services.Link{}, services.ErrLinkNotFound
+	} else if err != nil {
+		return services.Link{}, err
+	}
+	if row.IsDeleted {
+		return services.Link{}, services.ErrLinkDeleted
 	}
-	return row.OriginURL, nil
+	return row.link(), nil
 }
 
-func (c *Storage) GetAllUserURLs(ctx context.Context, userID string) (map[string]string, error) {
+func (c *Storage) GetAllUserURLs(ctx context.Context, userID string) ([]services.Link, error) {
 	rows := make([]Row, 0)
-	err := c.db.SelectContext(ctx, &rows, "SELECT id, origin_url, user_id FROM link WHERE user_id=$1 order by id", userID)
+	err := c.db.SelectContext(ctx, &rows, "SELECT id, short_key, origin_url, user_id, expires_at, redirect_status, merge_query, forward_path FROM link WHERE user_id=$1 AND NOT is_deleted order by id", userID)
 	if err != nil {
 		return nil, err
 	}
 
-	data := make(map[string]string)
+	data := make([]services.Link, len(rows))
 	for i := range rows {
-		row := rows[i]
-		data[fmt.Sprint(row.ID)] = row.OriginURL
+		data[i] = rows[i].link()
 	}
 
 	return data, nil
 }
 
-func (c *Storage) AddByBatch(ctx context.Context, urls []string, userID string) ([]string, error) {
-	if len(urls) == 0 {
+func (c *Storage) AddByBatch(ctx context.Context, links []services.Link, keyFunc services.KeyFunc) ([]string, error) {
+	if len(links) == 0 {
 		return make([]string, 0), nil
 	}
-	rows := make([]map[string]interface{}, len(urls))
-	for i := range urls {
-		rows[i] = map[string]interface{}{"user_id": userID, "origin_url": urls[i]}
-	}
 
-	// Open transaction on batch insert
-	tx, err := c.db.Begin()
-	if err != nil {
+	keys, err := c.insert(ctx, links, keyFunc)
+	if isUniqueViolation(err) {
+		c.log(ctx).Debug().Err(err).Msg("Unique violation on links insert")
+		return nil, c.conflict(ctx, links, err)
+	} else if err != nil {
+		c.log(ctx).Error().Err(err).Int("links", len(links)).Msg("Can't insert links")
 		return nil, err
 	}
-	defer tx.Rollback()
+	return keys, nil
+}
 
-	query := "INSERT INTO link(user_id, origin_url) VALUES(:user_id, :origin_url) returning id"
-	result, err := c.db.NamedQueryContext(ctx, query, rows)
+// insert adds links in one transaction, links without key get it from keyFunc.
+func (c *Storage) insert(ctx context.Context, links []services.Link, keyFunc services.KeyFunc) ([]string, error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
-	if err := tx.Commit(); err != nil {
-		return nil, err
-	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	keys := make([]string, len(links))
+	for i, link := range links {
+		// an expired link not swept yet frees its url for the new one
+		_, err := tx.ExecContext(ctx,
+			"UPDATE link SET is_deleted = TRUE WHERE origin_url = $1 AND expires_at <= $2 AND NOT is_deleted",
+			link.URL, now,
+		)
+		if err != nil {
+			return nil, err
+		}
 
-	// catch result from db
-	ids := make([]string, len(urls))
-	i := 0
-	for result.Next() {
-		var id string
-		err = result.Scan(&id)
+		var key sql.NullString
+		if link.Key != "" {
+			key = sql.NullString{String: link.Key, Valid: true}
+		}
+		var id int64
+		err = tx.GetContext(ctx, &id,
+			"INSERT INTO link(user_id, origin_url, short_key, expires_at, redirect_status, merge_query, forward_path) VALUES($1, $2, $3, $4, $5, $6, $7) returning id",
+			link.UserID, link.URL, key, utc(link.ExpiresAt), link.RedirectStatus, link.MergeQuery, link.ForwardPath,
+		)
 		if err != nil {
 			return nil, err
 		}
-		ids[i] = id
-		i = i + 1
+		if !key.Valid {
+			if key.String, id, err = c.freeKey(ctx, tx, keyFunc, id); err != nil {
+				return nil, err
+			}
+			key.Valid = true
+			_, err = tx.ExecContext(ctx, "UPDATE link SET short_key=$1 WHERE id=$2", key, id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		keys[i] = key.String
+	}
+	return keys, tx.Commit()
+}
+
+// renumberQueries move a link to a new id that is never handed out again.
+// The transaction rollback would free the id in sqlite, so it is done in place.
+var renumberQueries = map[string]string{
+	driverSqlite3:  "UPDATE link SET id = (SELECT MAX(id) + 1 FROM link) WHERE id = $1 RETURNING id",
+	driverPostgres: "UPDATE link SET id = nextval(pg_get_serial_sequence('link', 'id')) WHERE id = $1 RETURNING id",
+}
+
+// freeKey generates the key of an inserted link. A key taken by an alias
+// burns the id, the link is moved to the next one and gets its key.
+func (c *Storage) freeKey(ctx context.Context, tx *sqlx.Tx, keyFunc services.KeyFunc, id int64) (string, int64, error) {
+	for attempt := 1; ; attempt++ {
+		key, err := generateKey(keyFunc, id)
+		if err != nil {
+			return "", 0, err
+		}
+		var taken bool
+		err = tx.GetContext(ctx, &taken, "SELECT EXISTS (SELECT 1 FROM link WHERE short_key = $1)", key)
+		if err != nil {
+			return "", 0, err
+		}
+		if !taken || attempt == keyIDAttempts {
+			return key, id, nil
+		}
+		if err := tx.GetContext(ctx, &id, renumberQueries[c.db.DriverName()], id); err != nil {
+			return "", 0, err
+		}
+	}
+}
+
+// conflict explains unique violation: either the url is already shortened,
+// repeated in the batch or the key is taken.
+func (c *Storage) conflict(ctx context.Context, links []services.Link, err error) error {
+	urls := make(map[string]struct{}, len(links))
+	repeated := false
+	for _, link := range links {
+		if _, ok := urls[link.URL]; ok {
+			repeated = true
+		}
+		urls[link.URL] = struct{}{}
+
+		key, keyErr := c.GetURLKey(ctx, link.URL)
+		if errors.Is(keyErr, sql.ErrNoRows) {
+			continue
+		} else if keyErr != nil {
+			return keyErr
+		}
+		return services.NewLinkExistError(key, err)
 	}
-	err = result.Err()
+	if repeated {
+		return fmt.Errorf("%w: %v", services.ErrURLExists, err)
+	}
+	return fmt.Errorf("%w: %v", services.ErrKeyExists, err)
+}
+
+func (c *Storage) Delete(ctx context.Context, tasks []services.DeleteTask) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, task := range tasks {
+		if len(task.Keys) == 0 {
+			continue
+		}
+		query, args, err := sqlx.In(
+			"UPDATE link SET is_deleted = TRUE WHERE user_id = ? AND short_key IN (?)",
+			task.UserID, task.Keys,
+		)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
 
-	return ids, nil
+func (c *Storage) SweepExpired(ctx context.Context, before time.Time, archive bool) (int64, error) {
+	query := "DELETE FROM link WHERE expires_at <= $1"
+	if archive {
+		query = "UPDATE link SET is_deleted = TRUE WHERE expires_at <= $1 AND NOT is_deleted"
+	}
+	result, err := c.db.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		c.log(ctx).Error().Err(err).Bool("archive", archive).Msg("Can't sweep expired links")
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 func (c *Storage) GetURLKey(ctx context.Context, originURL string) (string, error) {
 	var row Row
-	if err := c.db.GetContext(ctx, &row, "SELECT * FROM link where origin_url=$1", originURL); err != nil {
+	if err := c.db.GetContext(ctx, &row, "SELECT * FROM link where origin_url=$1 AND NOT is_deleted", originURL); err != nil {
 		return "", err
 	}
-	return row.ID, nil
+	return row.Key, nil
+}
+
+func (c *Storage) log(ctx context.Context) *zerolog.Logger {
+	_, logger := logging.GetCtxLogger(ctx)
+	logger = logger.With().
+		Str(logging.Source, "Storage").
+		Str(logging.Layer, "storage").
+		Logger()
+
+	return &logger
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgerrcode.UniqueViolation
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// utc keeps stored times comparable, sqlite compares them as strings.
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// keyIDAttempts limits ids burned for one link when generated keys are taken.
+const keyIDAttempts = 5
+
+func generateKey(keyFunc services.KeyFunc, id int64) (string, error) {
+	if keyFunc == nil {
+		return strconv.FormatInt(id, 10), nil
+	}
+	return keyFunc(id)
 }
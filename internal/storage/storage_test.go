@@ -0,0 +1,368 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+func newTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("sqlite3", ":memory:?_foreign_keys=1")
+	assert.Nil(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestDB(t)
+
+	applied, err := MigrateUp(db)
+	assert.Nil(t, err)
+	assert.Len(t, applied, len(migrations))
+
+	version, err := CurrentVersion(db)
+	assert.Nil(t, err)
+	assert.Equal(t, LatestVersion(), version)
+
+	applied, err = MigrateUp(db)
+	assert.Nil(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := MigrateDown(db, len(migrations))
+	assert.Nil(t, err)
+	assert.Len(t, reverted, len(migrations))
+
+	states, err := MigrationStatus(db)
+	assert.Nil(t, err)
+	for _, state := range states {
+		assert.Nil(t, state.AppliedAt)
+	}
+
+	assert.Nil(t, Migrate(db))
+	states, err = MigrationStatus(db)
+	assert.Nil(t, err)
+	for _, state := range states {
+		assert.NotNil(t, state.AppliedAt)
+	}
+}
+
+func TestStorage_CheckMigrations(t *testing.T) {
+	db := newTestDB(t)
+	s, err := New(db)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	assert.Error(t, s.CheckMigrations(ctx))
+	assert.Nil(t, Migrate(db))
+	assert.Nil(t, s.CheckMigrations(ctx))
+	_, err = MigrateDown(db, 1)
+	assert.Nil(t, err)
+	assert.EqualError(t, s.CheckMigrations(ctx),
+		fmt.Sprintf("schema version is %d, expected %d", LatestVersion()-1, LatestVersion()))
+}
+
+func TestStorage_RedirectStatus(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	key, err := s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user1", RedirectStatus: 308}, nil)
+	assert.Nil(t, err)
+	link, err := s.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, 308, link.RedirectStatus)
+}
+
+func TestStorage_LinkOptions(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	_, err = s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user1", MergeQuery: true}, nil)
+	assert.Nil(t, err)
+	_, err = s.Add(ctx, services.Link{URL: "http://docs.example.com", UserID: "user1", ForwardPath: true}, nil)
+	assert.Nil(t, err)
+	links, err := s.GetAllUserURLs(ctx, "user1")
+	assert.Nil(t, err)
+	assert.Len(t, links, 2)
+	assert.True(t, links[0].MergeQuery)
+	assert.False(t, links[0].ForwardPath)
+	assert.False(t, links[1].MergeQuery)
+	assert.True(t, links[1].ForwardPath)
+}
+
+func TestStorage_AddConflict(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	key, err := s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user"}, nil)
+	assert.Nil(t, err)
+
+	_, err = s.Add(ctx, services.Link{URL: "http://example.com", UserID: "user"}, nil)
+	var existErr *services.LinkExistError
+	assert.True(t, errors.As(err, &existErr))
+	assert.Equal(t, key, existErr.Key)
+
+	key, err = s.Add(ctx, services.Link{Key: "summer-sale", URL: "http://example.com/sale", UserID: "user"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "summer-sale", key)
+
+	_, err = s.Add(ctx, services.Link{Key: "summer-sale", URL: "http://example.com/other", UserID: "user"}, nil)
+	assert.ErrorIs(t, err, services.ErrKeyExists)
+
+	link, err := s.Get(ctx, "summer-sale")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://example.com/sale", link.URL)
+}
+
+func TestStorage_AddAliasOfGeneratedKey(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	// the alias takes the key of the next id, which is burned
+	_, err = s.Add(ctx, services.Link{Key: "2", URL: "http://example.com/alias", UserID: "user"}, nil)
+	assert.Nil(t, err)
+	keys, err := s.AddByBatch(ctx, newLinks("user", "http://example.com/1", "http://example.com/2"), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3", "4"}, keys)
+	key, err := s.Add(ctx, services.Link{URL: "http://example.com/3", UserID: "user"}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "5", key)
+}
+
+func TestStorage_AddByBatchRepeatedURL(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	_, err = s.AddByBatch(ctx, newLinks("user", "http://example.com", "http://example.com"), nil)
+	assert.ErrorIs(t, err, ErrURLExists)
+	assert.ErrorIs(t, err, services.ErrConflict)
+	assert.False(t, errors.Is(err, services.ErrKeyExists))
+}
+
+func TestStorage_Delete(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	keys, err := s.AddByBatch(ctx, newLinks("user", "http://example.com", "http://example.com/2"), nil)
+	assert.Nil(t, err)
+
+	err = s.Delete(ctx, []services.DeleteTask{
+		{UserID: "user", Keys: []string{keys[0], "invalid"}},
+		{UserID: "other", Keys: []string{keys[1]}},
+	})
+	assert.Nil(t, err)
+
+	_, err = s.Get(ctx, keys[0])
+	assert.ErrorIs(t, err, services.ErrLinkDeleted)
+	_, err = s.Get(ctx, keys[1])
+	assert.Nil(t, err)
+
+	links, err := s.GetAllUserURLs(ctx, "user")
+	assert.Nil(t, err)
+	assert.Equal(t, []services.Link{{Key: keys[1], URL: "http://example.com/2", UserID: "user"}}, links)
+}
+
+func TestStorage_SweepExpired(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	keys, err := s.AddByBatch(ctx, []services.Link{
+		{URL: "http://example.com/1", UserID: "user", ExpiresAt: &past},
+		{URL: "http://example.com/2", UserID: "user", ExpiresAt: &future},
+		{URL: "http://example.com/3", UserID: "user"},
+	}, nil)
+	assert.Nil(t, err)
+
+	link, err := s.Get(ctx, keys[0])
+	assert.Nil(t, err)
+	assert.True(t, link.IsExpired(now))
+
+	count, err := s.SweepExpired(ctx, now, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	_, err = s.Get(ctx, keys[0])
+	assert.ErrorIs(t, err, services.ErrLinkDeleted)
+
+	count, err = s.SweepExpired(ctx, future, false)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+	_, err = s.Get(ctx, keys[1])
+	assert.ErrorIs(t, err, services.ErrLinkNotFound)
+
+	links, err := s.GetAllUserURLs(ctx, "user")
+	assert.Nil(t, err)
+	assert.Len(t, links, 1)
+}
+
+func TestStorage_AddExpiredURL(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	past := time.Now().Add(-time.Minute)
+	expired, err := s.Add(ctx, services.Link{URL: "http://example.com/1", UserID: "user", ExpiresAt: &past}, nil)
+	assert.Nil(t, err)
+	archived, err := s.Add(ctx, services.Link{URL: "http://example.com/2", UserID: "user", ExpiresAt: &past}, nil)
+	assert.Nil(t, err)
+	_, err = s.SweepExpired(ctx, time.Now(), true)
+	assert.Nil(t, err)
+	expired, err = s.Add(ctx, services.Link{URL: "http://example.com/3", UserID: "user", ExpiresAt: &past}, nil)
+	assert.Nil(t, err)
+
+	// both an archived and a not swept expired link free their urls
+	for _, url := range []string{"http://example.com/2", "http://example.com/3"} {
+		key, err := s.Add(ctx, services.Link{URL: url, UserID: "user"}, nil)
+		assert.Nil(t, err)
+		assert.NotEqual(t, expired, key)
+		assert.NotEqual(t, archived, key)
+
+		link, err := s.Get(ctx, key)
+		assert.Nil(t, err)
+		assert.Equal(t, url, link.URL)
+
+		_, err = s.Add(ctx, services.Link{URL: url, UserID: "user"}, nil)
+		var existErr *services.LinkExistError
+		assert.True(t, errors.As(err, &existErr))
+		assert.Equal(t, key, existErr.Key)
+	}
+	_, err = s.Get(ctx, expired)
+	assert.ErrorIs(t, err, services.ErrLinkDeleted)
+}
+
+func newLinks(userID string, urls ...string) []services.Link {
+	links := make([]services.Link, len(urls))
+	for i := range urls {
+		links[i] = services.Link{URL: urls[i], UserID: userID}
+	}
+	return links
+}
+
+func TestStorage_GetStats(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	day := time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC)
+	clicks := []services.Click{
+		{Key: "abc", At: day.Add(-time.Hour), IP: "10.0.0.0", UserAgent: "old"},
+		{Key: "abc", At: day.Add(time.Hour), IP: "10.0.0.0", UserAgent: "curl"},
+		{Key: "abc", At: day.Add(2 * time.Hour), IP: "10.0.0.0", UserAgent: "curl"},
+		{Key: "abc", At: day.Add(26 * time.Hour), IP: "10.0.1.0", UserAgent: "curl"},
+		{Key: "other", At: day.Add(time.Hour), IP: "10.0.0.0", UserAgent: "curl"},
+	}
+	assert.Nil(t, s.AddClicks(ctx, clicks))
+
+	expected := services.LinkStats{
+		Key:            "abc",
+		Total:          3,
+		UniqueVisitors: 2,
+		Buckets: []services.StatsBucket{
+			{Start: day, Clicks: 2},
+			{Start: day.Add(24 * time.Hour), Clicks: 1},
+		},
+	}
+	stats, err := s.GetStats(ctx, "abc", day, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, stats)
+
+	memory := NewMemoryStorage()
+	assert.Nil(t, memory.AddClicks(ctx, clicks))
+	stats, err = memory.GetStats(ctx, "abc", day, 24*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, stats)
+}
+
+func TestStorage_Accounts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	account := services.Account{ID: "account", Login: "alice", PasswordHash: "hash", CreatedAt: time.Now().UTC()}
+	assert.Nil(t, s.AddAccount(ctx, account))
+	assert.ErrorIs(t, s.AddAccount(ctx, services.Account{ID: "other", Login: "alice", PasswordHash: "hash"}), services.ErrLoginExists)
+
+	stored, err := s.GetAccount(ctx, "alice")
+	assert.Nil(t, err)
+	assert.Equal(t, "account", stored.ID)
+	_, err = s.GetAccount(ctx, "bob")
+	assert.ErrorIs(t, err, services.ErrAccountNotFound)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	assert.Error(t, s.AddSession(ctx, services.Session{ID: "unknown", UserID: "unknown", ExpiresAt: expiresAt}))
+	assert.Nil(t, s.AddSession(ctx, services.Session{ID: "session", UserID: "account", ExpiresAt: expiresAt}))
+	session, err := s.GetSession(ctx, "session")
+	assert.Nil(t, err)
+	assert.True(t, expiresAt.Equal(session.ExpiresAt))
+	assert.Nil(t, s.DeleteSession(ctx, "session"))
+	_, err = s.GetSession(ctx, "session")
+	assert.ErrorIs(t, err, services.ErrSessionNotFound)
+
+	_, err = s.AddByBatch(ctx, newLinks("anonymous", "http://example.com/1", "http://example.com/2"), nil)
+	assert.Nil(t, err)
+	count, err := s.MoveUserLinks(ctx, "anonymous", "account")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+	links, err := s.GetAllUserURLs(ctx, "account")
+	assert.Nil(t, err)
+	assert.Len(t, links, 2)
+}
+
+func TestStorage_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	assert.Nil(t, Migrate(db))
+	s, err := New(db)
+	assert.Nil(t, err)
+
+	key := services.APIKey{ID: "1", UserID: "user", Name: "ci", Hash: "hash", Scopes: []string{services.ScopeLinksCreate}, CreatedAt: time.Now().UTC()}
+	assert.Nil(t, s.AddAPIKey(ctx, key))
+
+	stored, err := s.GetAPIKey(ctx, "hash")
+	assert.Nil(t, err)
+	assert.Equal(t, key.Scopes, stored.Scopes)
+	keys, err := s.GetUserAPIKeys(ctx, "user")
+	assert.Nil(t, err)
+	assert.Len(t, keys, 1)
+
+	assert.ErrorIs(t, s.DeleteAPIKey(ctx, "other", "1"), services.ErrAPIKeyNotFound)
+	assert.Nil(t, s.DeleteAPIKey(ctx, "user", "1"))
+	_, err = s.GetAPIKey(ctx, "hash")
+	assert.ErrorIs(t, err, services.ErrAPIKeyNotFound)
+}
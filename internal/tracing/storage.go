@@ -0,0 +1,31 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/zueve/go-shortener/internal/observe"
+	"github.com/zueve/go-shortener/internal/services"
+)
+
+// NewStorage makes a client span named "Storage.<method>" of every storage query.
+func NewStorage(next services.StorageExpected) *observe.Storage {
+	tracer := otel.Tracer("github.com/zueve/go-shortener/internal/storage")
+	return observe.NewStorage(next, func(ctx context.Context, method string) (context.Context, func(error)) {
+		ctx, span := tracer.Start(ctx, "Storage."+method,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBOperationKey.String(method)),
+		)
+		return ctx, func(err error) {
+			if observe.IsFailure(err) {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	})
+}
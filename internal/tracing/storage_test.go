@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/zueve/go-shortener/internal/services"
+	"github.com/zueve/go-shortener/internal/storage"
+)
+
+func TestStorage(t *testing.T) {
+	assert := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	ctx := context.Background()
+	s := NewStorage(storage.NewMemoryStorage())
+	service := services.New(s)
+	defer service.Close(ctx)
+
+	key, err := service.CreateRedirect(ctx, services.Link{URL: "https://example.com", UserID: "user"})
+	assert.Nil(err)
+	_, err = service.GetRedirect(ctx, key)
+	assert.Nil(err)
+	_, err = service.GetRedirect(ctx, "unknown")
+	assert.ErrorIs(err, services.ErrNotFound)
+	assert.Nil(s.Close())
+
+	spans := recorder.Ended()
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name()
+		assert.NotEqual(codes.Error, span.Status().Code, span.Name())
+	}
+	assert.Equal([]string{
+		"Storage.Add", "Service.CreateRedirect",
+		"Storage.Get", "Service.GetRedirect",
+		"Storage.Get", "Service.GetRedirect",
+	}, names)
+	// storage spans are children of service spans
+	assert.Equal(spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
@@ -42,6 +42,22 @@ func SetCtxLogger(ctx context.Context, logger zerolog.Logger) context.Context {
 	return context.WithValue(ctx, contextKeyLogger, logger)
 }
 
+// WithCorrelationID stores the logger with the correlation ID field and the ID itself in the context.
+func WithCorrelationID(ctx context.Context, logger zerolog.Logger, id string) context.Context {
+	logger = logger.With().Str(CorrelationIDKey, id).Logger()
+	ctx = context.WithValue(ctx, contextKeyCorrelationID, id)
+
+	return SetCtxLogger(ctx, logger)
+}
+
+// WithTraceID adds trace and span ID fields to the logger stored within the context.
+func WithTraceID(ctx context.Context, traceID, spanID string) context.Context {
+	ctx, logger := GetCtxLogger(ctx)
+	logger = logger.With().Str(TraceIDKey, traceID).Str(SpanIDKey, spanID).Logger()
+
+	return SetCtxLogger(ctx, logger)
+}
+
 // GetCorrelationID returns the correlation ID contained within the context.
 func GetCorrelationID(ctx context.Context) (string, error) {
 	id, ok := ctx.Value(contextKeyCorrelationID).(string)
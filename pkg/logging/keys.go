@@ -3,6 +3,9 @@ package logging
 const (
 	// CorrelationIDKey defines the logging key for tracking the Correlation ID.
 	CorrelationIDKey = "correlation_id"
+	// TraceIDKey and SpanIDKey define the logging keys of the trace context.
+	TraceIDKey = "trace_id"
+	SpanIDKey  = "span_id"
 
 	// Source - info about logger producer
 	Source = "Source"
@@ -1,11 +1,47 @@
 package logging
 
 import (
+	"fmt"
+	"io"
 	"os"
+	"sync"
 
 	"github.com/rs/zerolog"
 )
 
+const (
+	FormatConsole = "console"
+	FormatJSON    = "json"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// Config defines loggers made by NewLogger.
+type Config struct {
+	// Level is a zerolog level name: trace, debug, info, warn, error
+	Level string
+	// Format is console for humans or json for log shipping
+	Format string
+	// Output is stdout, stderr or a file path
+	Output string
+	// MaxSize is a size in bytes of the log file to rotate it, zero disables rotation
+	MaxSize int64
+	// MaxBackups is a number of rotated files to keep
+	MaxBackups int
+	// Redact defines masking of secrets, URLs and IP addresses in every logged line
+	Redact RedactConfig
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultOutput io.Writer = redactWriter{
+		next:     zerolog.ConsoleWriter{Out: os.Stdout},
+		redactor: newRedactor(RedactConfig{}),
+	}
+	defaultLevel = zerolog.TraceLevel
+)
+
 // LoggerOption defines logger customization option.
 type LoggerOption func(logger zerolog.Logger) zerolog.Logger
 
@@ -16,11 +52,55 @@ func WithLogLevel(level zerolog.Level) LoggerOption {
 	}
 }
 
+// Setup configures level and output of loggers made by NewLogger afterwards.
+// The returned closer releases the log file.
+func Setup(cfg Config) (io.Closer, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		out    io.Writer
+		closer io.Closer = io.NopCloser(nil)
+	)
+	switch cfg.Output {
+	case "", OutputStdout:
+		out = os.Stdout
+	case OutputStderr:
+		out = os.Stderr
+	default:
+		file, err := NewRotatingFile(cfg.Output, cfg.MaxSize, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		out, closer = file, file
+	}
+
+	switch cfg.Format {
+	case "", FormatConsole:
+		out = zerolog.ConsoleWriter{Out: out, NoColor: out != os.Stdout && out != os.Stderr}
+	case FormatJSON:
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultOutput = redactWriter{next: out, redactor: newRedactor(cfg.Redact)}
+	defaultLevel = level
+	return closer, nil
+}
+
 // NewLogger creates a new customizable logger.
 func NewLogger(opts ...LoggerOption) zerolog.Logger {
-	logger := zerolog.New(os.Stdout).
-		Output(zerolog.ConsoleWriter{Out: os.Stdout}).
-		Level(zerolog.TraceLevel).
+	defaultMu.RLock()
+	out, level := defaultOutput, defaultLevel
+	defaultMu.RUnlock()
+
+	logger := zerolog.New(out).
+		Level(level).
 		With().
 		Timestamp().
 		Logger()
@@ -0,0 +1,144 @@
+package logging
+
+import (
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "***"
+
+// DefaultRedactedParams are query parameters masked in logged URLs.
+var DefaultRedactedParams = []string{
+	"token", "access_token", "refresh_token", "id_token", "api_key", "apikey", "key",
+	"password", "passwd", "secret", "client_secret", "signature", "sig", "auth", "code",
+}
+
+// sensitiveFields are fields masked whatever their values are.
+var sensitiveFields = map[string]bool{
+	"token": true, "password": true, "secret": true, "api_key": true, "session": true,
+	"authorization": true, "proxy-authorization": true, "cookie": true, "set-cookie": true,
+	"x-token": true, "x-api-key": true,
+}
+
+// ipFields are fields anonymized when RedactConfig.AnonymizeIP is set.
+var ipFields = map[string]bool{"remote_ip": true, "client_ip": true, "ip": true}
+
+var (
+	// stringFieldPattern matches a string field of a JSON log line
+	stringFieldPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)":"((?:[^"\\]|\\.)*)"`)
+	urlPattern         = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s"\\<>]+`)
+	// assignmentPattern matches secrets of key=value connection strings
+	assignmentPattern = regexp.MustCompile(`(?i)\b(password|passwd|secret|token)=[^\s"\\&]+`)
+)
+
+// RedactConfig defines masking of logged values.
+type RedactConfig struct {
+	// QueryParams are masked in URLs in addition to DefaultRedactedParams
+	QueryParams []string
+	// AnonymizeIP zeroes the host part of IP address fields
+	AnonymizeIP bool
+}
+
+type redactor struct {
+	params      map[string]bool
+	anonymizeIP bool
+}
+
+func newRedactor(cfg RedactConfig) redactor {
+	params := make(map[string]bool, len(DefaultRedactedParams)+len(cfg.QueryParams))
+	for _, list := range [][]string{DefaultRedactedParams, cfg.QueryParams} {
+		for _, param := range list {
+			if param = strings.TrimSpace(param); param != "" {
+				params[strings.ToLower(param)] = true
+			}
+		}
+	}
+	return redactor{params: params, anonymizeIP: cfg.AnonymizeIP}
+}
+
+// redactWriter masks every JSON log line before it is written, so call sites
+// and errors wrapping URLs or connection strings need no care.
+type redactWriter struct {
+	next     io.Writer
+	redactor redactor
+}
+
+func (w redactWriter) Write(p []byte) (int, error) {
+	if _, err := w.next.Write(w.redactor.line(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// line masks values of sensitive fields, IP fields and URLs or secrets inside other strings.
+func (r redactor) line(p []byte) []byte {
+	return stringFieldPattern.ReplaceAllFunc(p, func(field []byte) []byte {
+		match := stringFieldPattern.FindSubmatch(field)
+		name, value := string(match[1]), string(match[2])
+		switch {
+		case sensitiveFields[strings.ToLower(name)]:
+			value = maskSecret(value)
+		case ipFields[name]:
+			value = r.ip(value)
+		default:
+			value = r.text(value)
+		}
+		return []byte(`"` + name + `":"` + value + `"`)
+	})
+}
+
+func (r redactor) text(value string) string {
+	value = urlPattern.ReplaceAllStringFunc(value, r.url)
+	return assignmentPattern.ReplaceAllString(value, "$1="+redactedValue)
+}
+
+func maskSecret(value string) string {
+	// short values are masked completely, a prefix of them is too easy to guess
+	if len(value) < 16 {
+		return redactedValue
+	}
+	return value[:4] + redactedValue
+}
+
+func (r redactor) url(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	if u.RawQuery != "" {
+		// the query is masked in place to keep the order and encoding of parameters
+		pairs := strings.Split(u.RawQuery, "&")
+		for i, pair := range pairs {
+			rawName := strings.SplitN(pair, "=", 2)[0]
+			name, err := url.QueryUnescape(rawName)
+			if err != nil {
+				name = rawName
+			}
+			if r.params[strings.ToLower(name)] {
+				pairs[i] = rawName + "=" + redactedValue
+			}
+		}
+		u.RawQuery = strings.Join(pairs, "&")
+	}
+	return u.Redacted()
+}
+
+func (r redactor) ip(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if !r.anonymizeIP {
+		return addr
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return redactedValue
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,33 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "app.log")
+
+	f, err := NewRotatingFile(path, 10, 2)
+	assert.Nil(err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		assert.Nil(err)
+	}
+	assert.Nil(f.Close())
+
+	read := func(name string) string {
+		data, err := os.ReadFile(name)
+		assert.Nil(err)
+		return string(data)
+	}
+	assert.Equal("fourth\n", read(path))
+	assert.Equal("third\n", read(path+".1"))
+	assert.Equal("second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(os.IsNotExist(err))
+}